@@ -4,6 +4,7 @@ go 1.17
 
 require (
 	github.com/faiface/pixel v0.10.0
+	github.com/hajimehoshi/oto v0.7.1
 	golang.org/x/image v0.0.0-20190523035834-f03afa92d3ff
 )
 
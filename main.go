@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
 
 	"github.com/n-ulricksen/nes-emulator/nes"
+	"github.com/n-ulricksen/nes-emulator/nes/display"
+	"github.com/n-ulricksen/nes-emulator/nes/speaker"
 
 	"github.com/faiface/pixel/pixelgl"
 	"github.com/faiface/pixel/text"
@@ -14,35 +17,92 @@ import (
 var (
 	flagDebug   bool
 	flagLogging bool
+	flagRom     string
+	flagWav     string
+	flagFrames  int
 )
 
 func main() {
 	parseFlags()
 
+	if flagFrames > 0 {
+		runHeadless()
+		return
+	}
+
 	fmt.Println("Starting NES...")
 	nesEmulator := nes.NewBus(flagDebug, flagLogging)
 
-	// Load a test cartridge
-	cart := nes.NewCartridge("./roms/DK.nes")
-	//cart := nes.NewCartridge("./roms/SMB.nes")
-	//cart := nes.NewCartridge("./external_tests/nestest/nestest.nes")
+	// Load the cartridge
+	cart, err := nes.NewCartridge(flagRom)
+	if err != nil {
+		log.Fatalf("Unable to load %v\n%v\n", flagRom, err)
+	}
 	nesEmulator.InsertCartridge(cart)
 
+	// APU plays through the speaker, if there is a sound card.
+	spk, err := speaker.New()
+	if err != nil {
+		log.Printf("Unable to open audio device, running without sound\n%v\n", err)
+	} else {
+		defer spk.Close()
+		nesEmulator.ConnectAudioSink(spk)
+	}
+
+	if flagWav != "" {
+		err = nesEmulator.RecordWav(flagWav)
+		if err != nil {
+			log.Fatalf("Unable to record to %v\n%v\n", flagWav, err)
+		}
+	}
+
 	nesEmulator.Cpu.Disassemble(0x0000, 0xFFFF)
 
 	fmt.Println("Resetting NES...")
 	nesEmulator.Cpu.Reset()
 
-	pixelgl.Run(nesEmulator.Run)
+	pixelgl.Run(func() {
+		display.Run(nesEmulator)
+	})
 }
 
 func parseFlags() {
 	flag.BoolVar(&flagDebug, "d", false, "enable debug panel")
 	flag.BoolVar(&flagLogging, "l", false, "enable logging")
+	flag.StringVar(&flagRom, "r", "./roms/DK.nes", "ROM file to load")
+	flag.StringVar(&flagWav, "wav", "", "record audio to the given WAV file")
+	flag.IntVar(&flagFrames, "n", 0, "run the given number of frames without a window, then exit")
 
 	flag.Parse()
 }
 
+// runHeadless runs the NES without a window or sound card, e.g. to record
+// audio with -wav.
+func runHeadless() {
+	console := nes.NewConsole()
+
+	err := console.LoadROM(flagRom)
+	if err != nil {
+		log.Fatalf("Unable to load %v\n%v\n", flagRom, err)
+	}
+
+	if flagWav != "" {
+		err = console.RecordWav(flagWav)
+		if err != nil {
+			log.Fatalf("Unable to record to %v\n%v\n", flagWav, err)
+		}
+	}
+
+	for i := 0; i < flagFrames; i++ {
+		console.RunFrame()
+	}
+
+	err = console.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func printDebugMem(t *text.Text, nesEmu *nes.Bus) {
 	// Print 16 bytes per line.
 	ramRowLimit := 0x0010
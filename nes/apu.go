@@ -0,0 +1,267 @@
+package nes
+
+// NES audio processing unit, part of the 2A03 alongside the CPU. The APU is
+// clocked once per CPU cycle, and each channel's output is updated as it goes.
+//
+// References:
+// https://wiki.nesdev.com/w/index.php/APU
+// https://wiki.nesdev.com/w/index.php/APU_registers
+type Apu struct {
+	pulse    [2]*apuPulse // Pulse channels 1 and 2
+	triangle *apuTriangle
+	noise    *apuNoise
+	dmc      *apuDmc
+
+	frameCounter *apuFrameCounter
+
+	mixer    *audioMixer     // Mixes the channels' output for the audio sink
+	controls channelControls // Per-channel mute, solo and volume
+
+	expansion expansionAudio // The cartridge's own channels, if it has any
+
+	cycles uint64 // Total # of CPU cycles the APU has been clocked for
+}
+
+const (
+	// APU registers, as seen by the CPU
+	apuPulse1Addr uint16 = 0x4000 // $4000-$4003
+	apuPulse2Addr uint16 = 0x4004 // $4004-$4007
+	apuTriAddr    uint16 = 0x4008 // $4008-$400B
+	apuNoiseAddr  uint16 = 0x400C // $400C-$400F
+	apuDmcAddr    uint16 = 0x4010 // $4010-$4013
+	apuStatusAddr uint16 = 0x4015 // Channel enable/status
+	apuFrameAddr  uint16 = 0x4017 // Frame counter, shared with controller 2 reads
+)
+
+// expansionAudio is implemented by mappers with their own audio channels,
+// which are mixed with the APU's on the cartridge.
+type expansionAudio interface {
+	// audioOutput returns the mix of the mapper's channels, on the same
+	// scale as the APU's mixed output.
+	audioOutput() float32
+
+	// maxAudioOutput returns the highest level audioOutput can return, used
+	// to scale the expansion channel's level meter.
+	maxAudioOutput() float32
+}
+
+func NewApu() *Apu {
+	return &Apu{
+		pulse:    [2]*apuPulse{newApuPulse(1), newApuPulse(2)},
+		triangle: newApuTriangle(),
+		noise:    newApuNoise(),
+		dmc:      newApuDmc(),
+
+		frameCounter: newApuFrameCounter(),
+
+		mixer:    newAudioMixer(),
+		controls: newChannelControls(),
+	}
+}
+
+// ConnectAudioSink sets the sink the APU's output is written to. Mixing is
+// skipped entirely without a sink.
+func (a *Apu) ConnectAudioSink(s AudioSink) {
+	a.mixer.connect(s)
+}
+
+// connectExpansion mixes the expansion audio of the cartridge's mapper with
+// the APU's output, if the mapper has any.
+func (a *Apu) connectExpansion(m Mapper) {
+	a.expansion, _ = m.(expansionAudio)
+
+	a.controls.maxLevels[ChannelExpansion] = channelMaxLevels[ChannelExpansion]
+	if a.expansion != nil {
+		a.controls.maxLevels[ChannelExpansion] = a.expansion.maxAudioOutput()
+	}
+}
+
+// setTiming configures the APU for the console's region.
+func (a *Apu) setTiming(timing Timing) {
+	a.noise.setTiming(timing)
+	a.dmc.setTiming(timing)
+	a.frameCounter.setTiming(timing)
+
+	if timing == TimingPAL {
+		a.mixer.setClockRate(cpuClockPAL)
+	} else {
+		a.mixer.setClockRate(cpuClockNTSC)
+	}
+}
+
+// Reset the APU, silencing all channels and restarting the frame counter.
+func (a *Apu) Reset() {
+	a.cpuWrite(apuStatusAddr, 0x00)
+
+	fc := a.frameCounter
+	fc.irq = false
+	fc.cycle = 0
+	fc.resetDelay = 0
+}
+
+// levels returns each channel's current level.
+func (a *Apu) levels() [NumAudioChannels]float32 {
+	levels := [NumAudioChannels]float32{
+		ChannelPulse1:   float32(a.pulse[0].output()),
+		ChannelPulse2:   float32(a.pulse[1].output()),
+		ChannelTriangle: float32(a.triangle.output()),
+		ChannelNoise:    float32(a.noise.output()),
+		ChannelDmc:      float32(a.dmc.output()),
+	}
+	if a.expansion != nil {
+		levels[ChannelExpansion] = a.expansion.audioOutput()
+	}
+
+	return levels
+}
+
+// output returns the mix of every channel's level, from 0 to ~1, after
+// applying the channel controls.
+func (a *Apu) output(levels *[NumAudioChannels]float32) float32 {
+	if a.controls.unity {
+		return mixChannels(byte(levels[ChannelPulse1]), byte(levels[ChannelPulse2]),
+			byte(levels[ChannelTriangle]), byte(levels[ChannelNoise]), byte(levels[ChannelDmc])) +
+			levels[ChannelExpansion]
+	}
+
+	return mixChannelsGain(levels, &a.controls.gains)
+}
+
+// irq returns whether the APU is asserting the CPU's IRQ line.
+func (a *Apu) irq() bool {
+	return a.frameCounter.irq || a.dmc.irq
+}
+
+// 1 APU clock cycle, run once per CPU cycle.
+func (a *Apu) Clock() {
+	// Pulse timers are clocked every other CPU cycle.
+	if a.cycles%2 == 1 {
+		for _, p := range a.pulse {
+			p.clockTimer()
+		}
+	}
+	a.triangle.clockTimer()
+	a.noise.clockTimer()
+	a.dmc.clockTimer()
+
+	quarter, half := a.frameCounter.clock()
+	if quarter {
+		a.clockQuarterFrame()
+	}
+	if half {
+		a.clockHalfFrame()
+	}
+
+	if a.mixer.sink != nil || a.controls.meter {
+		levels := a.levels()
+		a.controls.updateLevels(&levels)
+
+		if a.mixer.sink != nil {
+			a.mixer.clock(a.output(&levels))
+		}
+	}
+
+	a.cycles++
+}
+
+// clockQuarterFrame clocks the envelopes, 4 times per frame.
+func (a *Apu) clockQuarterFrame() {
+	for _, p := range a.pulse {
+		p.clockQuarterFrame()
+	}
+	a.triangle.clockQuarterFrame()
+	a.noise.clockQuarterFrame()
+}
+
+// clockHalfFrame clocks the length counters and sweep units, twice per frame.
+func (a *Apu) clockHalfFrame() {
+	for _, p := range a.pulse {
+		p.clockHalfFrame()
+	}
+	a.triangle.clockHalfFrame()
+	a.noise.clockHalfFrame()
+}
+
+// Used by the CPU to read the APU's status register, $4015.
+func (a *Apu) cpuRead(addr uint16) byte {
+	if addr != apuStatusAddr {
+		return 0
+	}
+
+	// IF-D NT21: DMC interrupt, frame interrupt, DMC active, and whether each
+	// channel's length counter is above 0
+	var data byte
+	if a.pulse[0].length.counter > 0 {
+		data |= 0x01
+	}
+	if a.pulse[1].length.counter > 0 {
+		data |= 0x02
+	}
+	if a.triangle.length.counter > 0 {
+		data |= 0x04
+	}
+	if a.noise.length.counter > 0 {
+		data |= 0x08
+	}
+	if a.dmc.bytesRemaining > 0 {
+		data |= 0x10
+	}
+	if a.frameCounter.irq {
+		data |= 0x40
+	}
+	if a.dmc.irq {
+		data |= 0x80
+	}
+
+	// Reading clears the frame interrupt, but not the DMC interrupt.
+	a.frameCounter.irq = false
+
+	return data
+}
+
+// Used by the CPU to write to the APU's registers.
+func (a *Apu) cpuWrite(addr uint16, data byte) {
+	switch {
+	case addr >= apuPulse1Addr && addr < apuPulse2Addr:
+		a.pulse[0].write(addr-apuPulse1Addr, data)
+	case addr >= apuPulse2Addr && addr < apuTriAddr:
+		a.pulse[1].write(addr-apuPulse2Addr, data)
+	case addr >= apuTriAddr && addr < apuNoiseAddr:
+		a.triangle.write(addr-apuTriAddr, data)
+	case addr >= apuNoiseAddr && addr < apuDmcAddr:
+		a.noise.write(addr-apuNoiseAddr, data)
+	case addr >= apuDmcAddr && addr < apuDmcAddr+4:
+		a.dmc.write(addr-apuDmcAddr, data)
+	case addr == apuStatusAddr:
+		// ---D NT21: enable DMC, noise, triangle, pulse 2, pulse 1
+		a.pulse[0].length.setEnabled(data&0x01 > 0)
+		a.pulse[1].length.setEnabled(data&0x02 > 0)
+		a.triangle.length.setEnabled(data&0x04 > 0)
+		a.noise.length.setEnabled(data&0x08 > 0)
+		a.dmc.setEnabled(data&0x10 > 0)
+	case addr == apuFrameAddr:
+		a.frameCounter.write(data, a.cycles)
+	}
+}
+
+func (a *Apu) saveState(e *stateEncoder) {
+	for _, p := range a.pulse {
+		p.saveState(e)
+	}
+	a.triangle.saveState(e)
+	a.noise.saveState(e)
+	a.dmc.saveState(e)
+	a.frameCounter.saveState(e)
+	e.write(a.cycles)
+}
+
+func (a *Apu) loadState(d *stateDecoder) {
+	for _, p := range a.pulse {
+		p.loadState(d)
+	}
+	a.triangle.loadState(d)
+	a.noise.loadState(d)
+	a.dmc.loadState(d)
+	a.frameCounter.loadState(d)
+	d.read(&a.cycles)
+}
@@ -0,0 +1,179 @@
+package nes
+
+import (
+	"fmt"
+	"math"
+)
+
+// AudioChannel identifies one of the APU's channels, for the mute, solo and
+// volume controls.
+type AudioChannel int
+
+const (
+	ChannelPulse1 AudioChannel = iota
+	ChannelPulse2
+	ChannelTriangle
+	ChannelNoise
+	ChannelDmc
+	ChannelExpansion // Cartridge expansion audio, e.g. VRC6 or MMC5
+
+	NumAudioChannels int = iota
+)
+
+func (ch AudioChannel) String() string {
+	switch ch {
+	case ChannelPulse1:
+		return "pulse 1"
+	case ChannelPulse2:
+		return "pulse 2"
+	case ChannelTriangle:
+		return "triangle"
+	case ChannelNoise:
+		return "noise"
+	case ChannelDmc:
+		return "DMC"
+	case ChannelExpansion:
+		return "expansion"
+	}
+
+	return fmt.Sprintf("AudioChannel(%d)", int(ch))
+}
+
+const maxChannelVolume float32 = 2
+
+// Highest level output by each channel, used to scale the level meters. The
+// expansion channel's depends on the cartridge, see expansionAudio.
+var channelMaxLevels = [NumAudioChannels]float32{15, 15, 15, 15, 127, 1}
+
+// channelControls holds the mute, solo and volume settings for each channel.
+// These are settings of the emulator, not the NES, so they are not included
+// in save states.
+type channelControls struct {
+	volume [NumAudioChannels]float32
+	muted  [NumAudioChannels]bool
+	solo   [NumAudioChannels]bool
+
+	gains [NumAudioChannels]float32 // Combined effect of the settings
+	unity bool                      // Every gain is 1, no need to apply them
+
+	meter     bool                      // Track levels even when not mixing audio
+	levels    [NumAudioChannels]float32 // Peak levels since they were last read
+	maxLevels [NumAudioChannels]float32 // See channelMaxLevels
+}
+
+func newChannelControls() channelControls {
+	c := channelControls{maxLevels: channelMaxLevels}
+	for i := range c.volume {
+		c.volume[i] = 1
+	}
+	c.updateGains()
+
+	return c
+}
+
+func (c *channelControls) updateGains() {
+	soloing := false
+	for _, s := range c.solo {
+		soloing = soloing || s
+	}
+
+	c.unity = true
+	for i := range c.gains {
+		c.gains[i] = c.volume[i]
+		if c.muted[i] || (soloing && !c.solo[i]) {
+			c.gains[i] = 0
+		}
+		c.unity = c.unity && c.gains[i] == 1
+	}
+}
+
+func validChannel(ch AudioChannel) bool {
+	return ch >= 0 && int(ch) < NumAudioChannels
+}
+
+// SetChannelMuted mutes or unmutes one of the APU's channels.
+func (a *Apu) SetChannelMuted(ch AudioChannel, muted bool) {
+	if !validChannel(ch) {
+		return
+	}
+
+	a.controls.muted[ch] = muted
+	a.controls.updateGains()
+}
+
+func (a *Apu) ChannelMuted(ch AudioChannel) bool {
+	return validChannel(ch) && a.controls.muted[ch]
+}
+
+// SetChannelSolo solos one of the APU's channels. While any channel is soloed,
+// only soloed channels are heard.
+func (a *Apu) SetChannelSolo(ch AudioChannel, solo bool) {
+	if !validChannel(ch) {
+		return
+	}
+
+	a.controls.solo[ch] = solo
+	a.controls.updateGains()
+}
+
+func (a *Apu) ChannelSolo(ch AudioChannel) bool {
+	return validChannel(ch) && a.controls.solo[ch]
+}
+
+// SetChannelVolume sets the volume of one of the APU's channels, from 0 to 2,
+// where 1 is the channel's normal volume.
+func (a *Apu) SetChannelVolume(ch AudioChannel, volume float32) {
+	if !validChannel(ch) {
+		return
+	}
+
+	a.controls.volume[ch] = float32(math.Max(0, math.Min(float64(maxChannelVolume), float64(volume))))
+	a.controls.updateGains()
+}
+
+func (a *Apu) ChannelVolume(ch AudioChannel) float32 {
+	if !validChannel(ch) {
+		return 0
+	}
+
+	return a.controls.volume[ch]
+}
+
+// SetLevelMetering enables tracking each channel's level for ChannelLevels,
+// even while no audio sink is connected.
+func (a *Apu) SetLevelMetering(enabled bool) {
+	a.controls.meter = enabled
+}
+
+// ChannelLevels returns the peak level of each channel since the last call,
+// from 0 to 1, before the mute, solo and volume controls are applied. Levels
+// are only tracked while audio is being mixed, or metering is enabled.
+func (a *Apu) ChannelLevels() [NumAudioChannels]float32 {
+	levels := a.controls.levels
+	a.controls.levels = [NumAudioChannels]float32{}
+
+	return levels
+}
+
+// updateLevels records the channels' current levels for ChannelLevels.
+func (c *channelControls) updateLevels(levels *[NumAudioChannels]float32) {
+	for i, l := range levels {
+		l /= c.maxLevels[i]
+		if l > c.levels[i] {
+			c.levels[i] = l
+		}
+	}
+}
+
+// mixChannelsGain is mixChannels with a gain applied to each channel's level,
+// using the formulas the lookup tables are built from, so that the output
+// matches at unity gain.
+func mixChannelsGain(levels, gains *[NumAudioChannels]float32) float32 {
+	pulse := levels[ChannelPulse1]*gains[ChannelPulse1] + levels[ChannelPulse2]*gains[ChannelPulse2]
+	tnd := 3*levels[ChannelTriangle]*gains[ChannelTriangle] +
+		2*levels[ChannelNoise]*gains[ChannelNoise] +
+		levels[ChannelDmc]*gains[ChannelDmc]
+
+	return pulseMix(float64(pulse)) + tndMix(float64(tnd)) +
+		levels[ChannelExpansion]*gains[ChannelExpansion]
+}
@@ -0,0 +1,185 @@
+package nes
+
+// DMC output rates in CPU cycles, indexed by the 4 bits written to $4010.
+var (
+	dmcRatesNTSC = [16]uint16{
+		428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+	}
+	dmcRatesPAL = [16]uint16{
+		398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50,
+	}
+)
+
+const (
+	dmcSampleBase  uint16 = 0xC000 // Sample addresses start here, in 64 byte steps
+	dmcStallCycles int    = 4      // CPU cycles stalled by each sample fetch
+)
+
+// apuDmc is the APU's delta modulation channel, which plays 1-bit delta
+// encoded samples read from CPU memory. Each sample byte is fetched through
+// the bus, see Bus.initDmcTransfer.
+// reference: https://wiki.nesdev.com/w/index.php/APU_DMC
+type apuDmc struct {
+	rates *[16]uint16 // Rate table for the console's region
+
+	irqEnabled bool
+	loop       bool // Restart the sample once it finishes
+	rate       byte // Index into the rate table
+	irq        bool // Interrupt flag, set when a sample finishes without looping
+
+	timer uint16 // Counts down to the next output clock
+	level byte   // 7-bit output level
+
+	sampleAddr   uint16 // Start address of the sample
+	sampleLength uint16 // Length of the sample in bytes
+
+	// Memory reader
+	currentAddr    uint16
+	bytesRemaining uint16
+	buffer         byte // Sample buffer, filled by the memory reader
+	bufferEmpty    bool
+
+	// Output unit
+	shift         byte // Bits of the sample byte being played
+	bitsRemaining byte
+	silence       bool // Set when the sample buffer was empty
+}
+
+func newApuDmc() *apuDmc {
+	return &apuDmc{
+		rates:         &dmcRatesNTSC,
+		bufferEmpty:   true,
+		bitsRemaining: 8,
+		silence:       true,
+	}
+}
+
+// setTiming selects the rate table for the console's region.
+func (dmc *apuDmc) setTiming(timing Timing) {
+	if timing == TimingPAL {
+		dmc.rates = &dmcRatesPAL
+	} else {
+		dmc.rates = &dmcRatesNTSC
+	}
+}
+
+// Registers relative to $4010.
+func (dmc *apuDmc) write(reg uint16, data byte) {
+	switch reg {
+	case 0: // IL-- RRRR: IRQ enabled, loop, rate
+		dmc.irqEnabled = data&0x80 > 0
+		dmc.loop = data&0x40 > 0
+		dmc.rate = data & 0x0F
+		if !dmc.irqEnabled {
+			dmc.irq = false
+		}
+	case 1: // -DDD DDDD: direct load of the output level
+		dmc.level = data & 0x7F
+	case 2: // Sample address = $C000 + A * 64
+		dmc.sampleAddr = dmcSampleBase + uint16(data)*64
+	case 3: // Sample length = L * 16 + 1 bytes
+		dmc.sampleLength = uint16(data)*16 + 1
+	}
+}
+
+// setEnabled starts or stops the sample, as written to $4015.
+func (dmc *apuDmc) setEnabled(enabled bool) {
+	dmc.irq = false
+
+	if !enabled {
+		dmc.bytesRemaining = 0
+	} else if dmc.bytesRemaining == 0 {
+		dmc.restart()
+	}
+}
+
+func (dmc *apuDmc) restart() {
+	dmc.currentAddr = dmc.sampleAddr
+	dmc.bytesRemaining = dmc.sampleLength
+}
+
+// needsSample returns whether the memory reader is waiting for the next
+// sample byte to be fetched.
+func (dmc *apuDmc) needsSample() bool {
+	return dmc.bufferEmpty && dmc.bytesRemaining > 0
+}
+
+// fill gives the memory reader the sample byte fetched from currentAddr.
+func (dmc *apuDmc) fill(data byte) {
+	dmc.buffer = data
+	dmc.bufferEmpty = false
+
+	// Addresses wrap around to $8000.
+	if dmc.currentAddr == 0xFFFF {
+		dmc.currentAddr = 0x8000
+	} else {
+		dmc.currentAddr++
+	}
+
+	dmc.bytesRemaining--
+	if dmc.bytesRemaining == 0 {
+		if dmc.loop {
+			dmc.restart()
+		} else if dmc.irqEnabled {
+			dmc.irq = true
+		}
+	}
+}
+
+// clockTimer is called every CPU cycle.
+func (dmc *apuDmc) clockTimer() {
+	if dmc.timer > 0 {
+		dmc.timer--
+		return
+	}
+
+	dmc.timer = dmc.rates[dmc.rate] - 1
+	dmc.clockOutput()
+}
+
+func (dmc *apuDmc) clockOutput() {
+	if !dmc.silence {
+		if dmc.shift&1 == 1 {
+			if dmc.level <= 125 {
+				dmc.level += 2
+			}
+		} else if dmc.level >= 2 {
+			dmc.level -= 2
+		}
+	}
+	dmc.shift >>= 1
+
+	dmc.bitsRemaining--
+	if dmc.bitsRemaining > 0 {
+		return
+	}
+
+	// Start a new output cycle with the next sample byte.
+	dmc.bitsRemaining = 8
+	if dmc.bufferEmpty {
+		dmc.silence = true
+	} else {
+		dmc.silence = false
+		dmc.shift = dmc.buffer
+		dmc.bufferEmpty = true
+	}
+}
+
+// output returns the channel's current level, 0-127.
+func (dmc *apuDmc) output() byte {
+	return dmc.level
+}
+
+func (dmc *apuDmc) saveState(e *stateEncoder) {
+	e.write(dmc.irqEnabled, dmc.loop, dmc.rate, dmc.irq, dmc.timer, dmc.level)
+	e.write(dmc.sampleAddr, dmc.sampleLength, dmc.currentAddr, dmc.bytesRemaining,
+		dmc.buffer, dmc.bufferEmpty)
+	e.write(dmc.shift, dmc.bitsRemaining, dmc.silence)
+}
+
+func (dmc *apuDmc) loadState(d *stateDecoder) {
+	d.read(&dmc.irqEnabled, &dmc.loop, &dmc.rate, &dmc.irq, &dmc.timer, &dmc.level)
+	d.read(&dmc.sampleAddr, &dmc.sampleLength, &dmc.currentAddr, &dmc.bytesRemaining,
+		&dmc.buffer, &dmc.bufferEmpty)
+	d.read(&dmc.shift, &dmc.bitsRemaining, &dmc.silence)
+}
@@ -0,0 +1,101 @@
+package nes
+
+// CPU cycles at which each step of the frame sequence happens. The 4-step
+// sequence ends after step 4, the 5-step sequence after step 5.
+var (
+	frameStepsNTSC = [5]uint32{7457, 14913, 22371, 29829, 37281}
+	frameStepsPAL  = [5]uint32{8313, 16627, 24939, 33253, 41565}
+)
+
+// apuFrameCounter drives the channels' envelopes, sweeps, length and linear
+// counters at a few fixed points in each frame, and can raise an IRQ at the
+// end of the 4-step sequence.
+// reference: https://wiki.nesdev.com/w/index.php/APU_Frame_Counter
+type apuFrameCounter struct {
+	steps *[5]uint32 // Step timing for the console's region
+
+	fiveStep   bool // 5-step sequence, rather than 4-step
+	irqInhibit bool
+	irq        bool // Frame interrupt flag
+
+	cycle      uint32 // CPU cycles since the sequence started
+	resetDelay byte   // CPU cycles until a $4017 write restarts the sequence
+}
+
+func newApuFrameCounter() *apuFrameCounter {
+	return &apuFrameCounter{
+		steps: &frameStepsNTSC,
+	}
+}
+
+// setTiming selects the step timing for the console's region.
+func (fc *apuFrameCounter) setTiming(timing Timing) {
+	if timing == TimingPAL {
+		fc.steps = &frameStepsPAL
+	} else {
+		fc.steps = &frameStepsNTSC
+	}
+}
+
+// write handles writes to $4017: MI-- ----, mode and IRQ inhibit. The
+// sequence restarts 3 or 4 CPU cycles later, depending on whether the write
+// happens on an odd or even cycle.
+func (fc *apuFrameCounter) write(data byte, cycles uint64) {
+	fc.fiveStep = data&0x80 > 0
+	fc.irqInhibit = data&0x40 > 0
+	if fc.irqInhibit {
+		fc.irq = false
+	}
+
+	fc.resetDelay = 3
+	if cycles%2 == 1 {
+		fc.resetDelay = 4
+	}
+}
+
+// clock is called every CPU cycle, returning whether to clock the quarter
+// frame and half frame units.
+func (fc *apuFrameCounter) clock() (quarter, half bool) {
+	if fc.resetDelay > 0 {
+		fc.resetDelay--
+		if fc.resetDelay == 0 {
+			fc.cycle = 0
+
+			// The 5-step sequence clocks every unit straight away.
+			if fc.fiveStep {
+				return true, true
+			}
+			return false, false
+		}
+	}
+
+	fc.cycle++
+
+	switch fc.cycle {
+	case fc.steps[0], fc.steps[2]:
+		quarter = true
+	case fc.steps[1]:
+		quarter, half = true, true
+	case fc.steps[3]:
+		if !fc.fiveStep {
+			quarter, half = true, true
+			if !fc.irqInhibit {
+				fc.irq = true
+			}
+			fc.cycle = 0
+		}
+	case fc.steps[4]:
+		quarter, half = true, true
+		fc.cycle = 0
+	}
+
+	return quarter, half
+}
+
+func (fc *apuFrameCounter) saveState(e *stateEncoder) {
+	e.write(fc.fiveStep, fc.irqInhibit, fc.irq, fc.cycle, fc.resetDelay)
+}
+
+func (fc *apuFrameCounter) loadState(d *stateDecoder) {
+	d.read(&fc.fiveStep, &fc.irqInhibit, &fc.irq, &fc.cycle, &fc.resetDelay)
+}
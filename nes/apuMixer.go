@@ -0,0 +1,287 @@
+package nes
+
+import (
+	"math"
+)
+
+// The APU's channels are mixed once per CPU cycle, producing a signal at
+// ~1.79MHz. The mixer turns this into samples at the audio sink's rate with
+// band-limited synthesis: each change in level is added to the output as a
+// band-limited step, so nothing above the output's Nyquist frequency aliases
+// into the audible range. The samples are then filtered like the NES's own
+// output circuit.
+//
+// References:
+// https://wiki.nesdev.com/w/index.php/APU_Mixer
+// http://slack.net/~ant/bl-synth/
+
+const (
+	cpuClockNTSC float64 = 1789773 // CPU cycles per second
+	cpuClockPAL  float64 = 1662607
+
+	audioFlushClocks int = 1024 // CPU cycles between writes to the audio sink
+
+	blipTaps   int = 16 // Width of the band-limited step, in output samples
+	blipPhases int = 32 // Sub-sample positions the step is computed for
+)
+
+// Lookup tables for the NES's nonlinear mixing of the pulse channels, and of
+// the triangle, noise and DMC channels, see pulseMix and tndMix.
+var (
+	pulseMixTable [31]float32
+	tndMixTable   [203]float32
+)
+
+// Band-limited impulses for each sub-sample phase. Adding one to the deltas
+// of a blipBuffer adds a band-limited step to its output.
+var blipKernel [blipPhases][blipTaps]float32
+
+func init() {
+	for i := 1; i < len(pulseMixTable); i++ {
+		pulseMixTable[i] = pulseMix(float64(i))
+	}
+	for i := 1; i < len(tndMixTable); i++ {
+		tndMixTable[i] = tndMix(float64(i))
+	}
+
+	// Blackman windowed sinc, cut off a little below the Nyquist frequency.
+	const cutoff = 0.45 // Cycles per output sample
+	for phase := range blipKernel {
+		frac := float64(phase) / float64(blipPhases)
+
+		var sum float64
+		var taps [blipTaps]float64
+		for k := range taps {
+			x := float64(k-blipTaps/2) - frac
+			taps[k] = sinc(2*cutoff*x) * blackman(x+float64(blipTaps)/2, float64(blipTaps))
+			sum += taps[k]
+		}
+
+		// Each step should add exactly its delta to the output.
+		for k := range taps {
+			blipKernel[phase][k] = float32(taps[k] / sum)
+		}
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman returns the Blackman window of width n at x, 0 outside of [0, n].
+func blackman(x, n float64) float64 {
+	if x < 0 || x > n {
+		return 0
+	}
+
+	return 0.42 - 0.5*math.Cos(2*math.Pi*x/n) + 0.08*math.Cos(4*math.Pi*x/n)
+}
+
+// pulseMix returns the output level of the pulse channels, given the sum of
+// their levels.
+func pulseMix(pulse float64) float32 {
+	if pulse <= 0 {
+		return 0
+	}
+
+	return float32(95.52 / (8128/pulse + 100))
+}
+
+// tndMix returns the output level of the triangle, noise and DMC channels,
+// given 3*triangle + 2*noise + DMC.
+func tndMix(tnd float64) float32 {
+	if tnd <= 0 {
+		return 0
+	}
+
+	return float32(163.67 / (24329/tnd + 100))
+}
+
+// mixChannels combines each channel's level into the NES's output level,
+// ranging from 0 to ~1.
+func mixChannels(pulse1, pulse2, triangle, noise, dmc byte) float32 {
+	return pulseMixTable[pulse1+pulse2] +
+		tndMixTable[3*int(triangle)+2*int(noise)+int(dmc)]
+}
+
+// blipBuffer resamples a signal clocked at a high rate to a lower sample
+// rate. Changes in the signal are added as band-limited steps, and the output
+// is the running sum of them. The output lags the input by half of the
+// step's width.
+type blipBuffer struct {
+	samplesPerClock float64
+
+	time   float64   // Current time in output samples, relative to deltas[0]
+	deltas []float32 // Band-limited impulses, summed to produce the output
+	sum    float32   // Running sum of the deltas read so far
+}
+
+func (bb *blipBuffer) setRates(clockRate, sampleRate float64) {
+	bb.samplesPerClock = sampleRate / clockRate
+	bb.time = 0
+	bb.sum = 0
+
+	size := int(float64(audioFlushClocks)*bb.samplesPerClock) + blipTaps + 2
+	bb.deltas = make([]float32, size)
+}
+
+// addDelta changes the signal's level by delta at the current time.
+func (bb *blipBuffer) addDelta(delta float32) {
+	i := int(bb.time)
+	phase := int((bb.time - float64(i)) * float64(blipPhases))
+
+	for k, tap := range blipKernel[phase] {
+		bb.deltas[i+k] += delta * tap
+	}
+}
+
+// clock advances the current time by 1 input clock.
+func (bb *blipBuffer) clock() {
+	bb.time += bb.samplesPerClock
+}
+
+// readSamples appends each output sample that is complete to out.
+func (bb *blipBuffer) readSamples(out []float32) []float32 {
+	n := int(bb.time)
+	for _, delta := range bb.deltas[:n] {
+		bb.sum += delta
+		out = append(out, bb.sum)
+	}
+
+	// Move the remaining deltas to the front of the buffer.
+	copy(bb.deltas, bb.deltas[n:])
+	for i := len(bb.deltas) - n; i < len(bb.deltas); i++ {
+		bb.deltas[i] = 0
+	}
+	bb.time -= float64(n)
+
+	return out
+}
+
+// First order high-pass filter.
+type highPassFilter struct {
+	alpha   float32
+	prevIn  float32
+	prevOut float32
+}
+
+func newHighPassFilter(cutoff, sampleRate float64) highPassFilter {
+	rc := 1 / (2 * math.Pi * cutoff)
+	dt := 1 / sampleRate
+
+	return highPassFilter{alpha: float32(rc / (rc + dt))}
+}
+
+func (f *highPassFilter) filter(x float32) float32 {
+	f.prevOut = f.alpha * (f.prevOut + x - f.prevIn)
+	f.prevIn = x
+
+	return f.prevOut
+}
+
+// First order low-pass filter.
+type lowPassFilter struct {
+	alpha   float32
+	prevOut float32
+}
+
+func newLowPassFilter(cutoff, sampleRate float64) lowPassFilter {
+	rc := 1 / (2 * math.Pi * cutoff)
+	dt := 1 / sampleRate
+
+	return lowPassFilter{alpha: float32(dt / (rc + dt))}
+}
+
+func (f *lowPassFilter) filter(x float32) float32 {
+	f.prevOut += f.alpha * (x - f.prevOut)
+
+	return f.prevOut
+}
+
+// audioMixer turns the APU's output level, sampled every CPU cycle, into
+// filtered samples written to an AudioSink.
+type audioMixer struct {
+	sink      AudioSink
+	clockRate float64 // CPU cycles per second
+
+	blip   blipBuffer
+	level  float32 // Output level at the last clock
+	clocks int     // CPU cycles since the last write to the sink
+
+	// The NES's output filters
+	highPass90  highPassFilter
+	highPass440 highPassFilter
+	lowPass14k  lowPassFilter
+
+	samples []float32 // Reused for each write to the sink
+}
+
+func newAudioMixer() *audioMixer {
+	return &audioMixer{
+		clockRate: cpuClockNTSC,
+	}
+}
+
+// connect sets the sink the mixer writes to, or disables mixing if nil.
+func (m *audioMixer) connect(sink AudioSink) {
+	m.sink = sink
+	m.reset()
+}
+
+func (m *audioMixer) setClockRate(clockRate float64) {
+	m.clockRate = clockRate
+	m.reset()
+}
+
+// reset clears the mixer's state, for a new sink or clock rate.
+func (m *audioMixer) reset() {
+	if m.sink == nil {
+		return
+	}
+
+	sampleRate := float64(m.sink.SampleRate())
+	m.blip.setRates(m.clockRate, sampleRate)
+	m.level = 0
+	m.clocks = 0
+
+	m.highPass90 = newHighPassFilter(90, sampleRate)
+	m.highPass440 = newHighPassFilter(440, sampleRate)
+	m.lowPass14k = newLowPassFilter(14000, sampleRate)
+}
+
+// clock is called every CPU cycle with the APU's output level.
+func (m *audioMixer) clock(level float32) {
+	if level != m.level {
+		m.blip.addDelta(level - m.level)
+		m.level = level
+	}
+	m.blip.clock()
+
+	m.clocks++
+	if m.clocks >= audioFlushClocks {
+		m.flush()
+	}
+}
+
+// flush filters the completed samples, and writes them to the sink.
+func (m *audioMixer) flush() {
+	m.clocks = 0
+	if m.sink == nil {
+		return
+	}
+
+	m.samples = m.blip.readSamples(m.samples[:0])
+	for i, s := range m.samples {
+		s = m.highPass90.filter(s)
+		s = m.highPass440.filter(s)
+		m.samples[i] = m.lowPass14k.filter(s)
+	}
+
+	if len(m.samples) > 0 {
+		m.sink.WriteSamples(m.samples)
+	}
+}
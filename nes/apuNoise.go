@@ -0,0 +1,105 @@
+package nes
+
+// Noise timer periods in CPU cycles, indexed by the 4 bits written to $400E.
+var (
+	noisePeriodsNTSC = [16]uint16{
+		4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+	}
+	noisePeriodsPAL = [16]uint16{
+		4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778,
+	}
+)
+
+// apuNoise is the APU's noise channel, a pseudo-random bit stream from a
+// 15-bit linear feedback shift register.
+// reference: https://wiki.nesdev.com/w/index.php/APU_Noise
+type apuNoise struct {
+	periods *[16]uint16 // Period table for the console's region
+
+	shift uint16 // Linear feedback shift register, never 0
+	mode  bool   // Short mode, feedback from bit 6 rather than bit 1
+
+	timer  uint16 // Counts down to the next shift
+	period byte   // Index into the period table
+
+	envelope apuEnvelope
+	length   apuLengthCounter
+}
+
+func newApuNoise() *apuNoise {
+	return &apuNoise{
+		periods: &noisePeriodsNTSC,
+		shift:   1,
+	}
+}
+
+// setTiming selects the period table for the console's region.
+func (n *apuNoise) setTiming(timing Timing) {
+	if timing == TimingPAL {
+		n.periods = &noisePeriodsPAL
+	} else {
+		n.periods = &noisePeriodsNTSC
+	}
+}
+
+// Registers relative to $400C.
+func (n *apuNoise) write(reg uint16, data byte) {
+	switch reg {
+	case 0: // --LC VVVV: length counter halt/envelope loop, envelope
+		n.length.halt = data&0x20 > 0
+		n.envelope.write(data)
+	case 1: // Unused
+	case 2: // M--- PPPP: mode, period
+		n.mode = data&0x80 > 0
+		n.period = data & 0x0F
+	case 3: // LLLL L---: length counter load
+		n.length.load(data >> 3)
+		n.envelope.start = true
+	}
+}
+
+// clockTimer is called every CPU cycle.
+func (n *apuNoise) clockTimer() {
+	if n.timer > 0 {
+		n.timer--
+		return
+	}
+
+	n.timer = n.periods[n.period] - 1
+
+	tap := uint16(1)
+	if n.mode {
+		tap = 6
+	}
+	feedback := (n.shift ^ n.shift>>tap) & 1
+	n.shift = n.shift>>1 | feedback<<14
+}
+
+func (n *apuNoise) clockQuarterFrame() {
+	n.envelope.clock()
+}
+
+func (n *apuNoise) clockHalfFrame() {
+	n.length.clock()
+}
+
+// output returns the channel's current volume, 0-15.
+func (n *apuNoise) output() byte {
+	if n.length.counter == 0 || n.shift&1 == 1 {
+		return 0
+	}
+
+	return n.envelope.output()
+}
+
+func (n *apuNoise) saveState(e *stateEncoder) {
+	e.write(n.shift, n.mode, n.timer, n.period)
+	n.envelope.saveState(e)
+	n.length.saveState(e)
+}
+
+func (n *apuNoise) loadState(d *stateDecoder) {
+	d.read(&n.shift, &n.mode, &n.timer, &n.period)
+	n.envelope.loadState(d)
+	n.length.loadState(d)
+}
@@ -0,0 +1,143 @@
+package nes
+
+// Pulse wave sequences for each duty cycle, 12.5%, 25%, 50% and 25% negated.
+var pulseDutyTable = [4][8]byte{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+// apuPulse is one of the APU's 2 pulse (square wave) channels.
+// reference: https://wiki.nesdev.com/w/index.php/APU_Pulse
+type apuPulse struct {
+	channel byte // 1 or 2, the sweep units negate differently
+
+	duty     byte // Duty cycle, index into pulseDutyTable
+	sequence byte // Step in the duty cycle's sequence
+
+	timer       uint16 // Counts down to the next sequencer step
+	timerPeriod uint16 // 11 bits
+
+	envelope apuEnvelope
+	length   apuLengthCounter
+
+	// Sweep unit, periodically adjusts the timer period
+	sweepEnabled bool
+	sweepPeriod  byte
+	sweepNegate  bool
+	sweepShift   byte
+	sweepDivider byte
+	sweepReload  bool
+}
+
+func newApuPulse(channel byte) *apuPulse {
+	return &apuPulse{
+		channel: channel,
+	}
+}
+
+// Registers relative to the channel's first register ($4000 or $4004).
+func (p *apuPulse) write(reg uint16, data byte) {
+	switch reg {
+	case 0: // DDLC VVVV: duty, length counter halt/envelope loop, envelope
+		p.duty = data >> 6
+		p.length.halt = data&0x20 > 0
+		p.envelope.write(data)
+	case 1: // EPPP NSSS: sweep enabled, period, negate, shift
+		p.sweepEnabled = data&0x80 > 0
+		p.sweepPeriod = (data >> 4) & 0x07
+		p.sweepNegate = data&0x08 > 0
+		p.sweepShift = data & 0x07
+		p.sweepReload = true
+	case 2: // Timer low 8 bits
+		p.timerPeriod = p.timerPeriod&0x0700 | uint16(data)
+	case 3: // LLLL Lttt: length counter load, timer high 3 bits
+		p.timerPeriod = p.timerPeriod&0x00FF | uint16(data&0x07)<<8
+		p.length.load(data >> 3)
+		p.sequence = 0
+		p.envelope.start = true
+	}
+}
+
+// clockTimer is called every APU cycle (2 CPU cycles).
+func (p *apuPulse) clockTimer() {
+	if p.timer > 0 {
+		p.timer--
+		return
+	}
+
+	p.timer = p.timerPeriod
+	p.sequence = (p.sequence + 1) & 0x07
+}
+
+func (p *apuPulse) clockQuarterFrame() {
+	p.envelope.clock()
+}
+
+func (p *apuPulse) clockHalfFrame() {
+	p.length.clock()
+	p.clockSweep()
+}
+
+func (p *apuPulse) clockSweep() {
+	if p.sweepDivider == 0 && p.sweepEnabled && p.sweepShift > 0 && !p.sweepMuting() {
+		p.timerPeriod = p.sweepTarget()
+	}
+
+	if p.sweepDivider == 0 || p.sweepReload {
+		p.sweepDivider = p.sweepPeriod
+		p.sweepReload = false
+	} else {
+		p.sweepDivider--
+	}
+}
+
+// sweepTarget returns the period the sweep unit would change the timer to.
+// Pulse 1 negates with ones' complement, subtracting 1 more than pulse 2.
+func (p *apuPulse) sweepTarget() uint16 {
+	change := p.timerPeriod >> p.sweepShift
+	if !p.sweepNegate {
+		return p.timerPeriod + change
+	}
+
+	if p.channel == 1 {
+		change++
+	}
+	if change > p.timerPeriod {
+		return 0
+	}
+
+	return p.timerPeriod - change
+}
+
+// sweepMuting returns whether the channel is silenced by the sweep unit, even
+// when the sweep is disabled.
+func (p *apuPulse) sweepMuting() bool {
+	return p.timerPeriod < 8 || p.sweepTarget() > 0x07FF
+}
+
+// output returns the channel's current volume, 0-15.
+func (p *apuPulse) output() byte {
+	if p.length.counter == 0 || p.sweepMuting() || pulseDutyTable[p.duty][p.sequence] == 0 {
+		return 0
+	}
+
+	return p.envelope.output()
+}
+
+func (p *apuPulse) saveState(e *stateEncoder) {
+	e.write(p.duty, p.sequence, p.timer, p.timerPeriod)
+	p.envelope.saveState(e)
+	p.length.saveState(e)
+	e.write(p.sweepEnabled, p.sweepPeriod, p.sweepNegate, p.sweepShift,
+		p.sweepDivider, p.sweepReload)
+}
+
+func (p *apuPulse) loadState(d *stateDecoder) {
+	d.read(&p.duty, &p.sequence, &p.timer, &p.timerPeriod)
+	p.envelope.loadState(d)
+	p.length.loadState(d)
+	d.read(&p.sweepEnabled, &p.sweepPeriod, &p.sweepNegate, &p.sweepShift,
+		&p.sweepDivider, &p.sweepReload)
+}
@@ -0,0 +1,97 @@
+package nes
+
+// Triangle wave sequence, stepped through by the triangle channel.
+var triangleSequence = [32]byte{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// apuTriangle is the APU's triangle wave channel. It has no volume control,
+// instead it is silenced by halting the sequencer, which holds the output at
+// its current level.
+// reference: https://wiki.nesdev.com/w/index.php/APU_Triangle
+type apuTriangle struct {
+	sequence byte // Step in triangleSequence
+
+	timer       uint16 // Counts down to the next sequencer step
+	timerPeriod uint16 // 11 bits
+
+	length apuLengthCounter
+
+	// Linear counter, a finer grained length counter clocked on quarter frames
+	linearCounter byte
+	linearReload  byte // Value the linear counter is reloaded with
+	linearControl bool // Keep reloading the linear counter, also halts the length counter
+	linearStart   bool // Reload the linear counter on the next quarter frame
+}
+
+func newApuTriangle() *apuTriangle {
+	return &apuTriangle{}
+}
+
+// Registers relative to $4008.
+func (t *apuTriangle) write(reg uint16, data byte) {
+	switch reg {
+	case 0: // CRRR RRRR: length counter halt/linear counter control, reload value
+		t.linearControl = data&0x80 > 0
+		t.length.halt = t.linearControl
+		t.linearReload = data & 0x7F
+	case 1: // Unused
+	case 2: // Timer low 8 bits
+		t.timerPeriod = t.timerPeriod&0x0700 | uint16(data)
+	case 3: // LLLL Lttt: length counter load, timer high 3 bits
+		t.timerPeriod = t.timerPeriod&0x00FF | uint16(data&0x07)<<8
+		t.length.load(data >> 3)
+		t.linearStart = true
+	}
+}
+
+// clockTimer is called every CPU cycle.
+func (t *apuTriangle) clockTimer() {
+	if t.timer > 0 {
+		t.timer--
+		return
+	}
+
+	t.timer = t.timerPeriod
+
+	// Periods below 2 produce ultrasonic frequencies, which real hardware
+	// outputs but can't be heard. The sequencer is stopped instead, as the
+	// resulting pops are worse than the silence.
+	if t.length.counter > 0 && t.linearCounter > 0 && t.timerPeriod >= 2 {
+		t.sequence = (t.sequence + 1) & 0x1F
+	}
+}
+
+func (t *apuTriangle) clockQuarterFrame() {
+	if t.linearStart {
+		t.linearCounter = t.linearReload
+	} else if t.linearCounter > 0 {
+		t.linearCounter--
+	}
+
+	if !t.linearControl {
+		t.linearStart = false
+	}
+}
+
+func (t *apuTriangle) clockHalfFrame() {
+	t.length.clock()
+}
+
+// output returns the channel's current level, 0-15.
+func (t *apuTriangle) output() byte {
+	return triangleSequence[t.sequence]
+}
+
+func (t *apuTriangle) saveState(e *stateEncoder) {
+	e.write(t.sequence, t.timer, t.timerPeriod)
+	t.length.saveState(e)
+	e.write(t.linearCounter, t.linearReload, t.linearControl, t.linearStart)
+}
+
+func (t *apuTriangle) loadState(d *stateDecoder) {
+	d.read(&t.sequence, &t.timer, &t.timerPeriod)
+	t.length.loadState(d)
+	d.read(&t.linearCounter, &t.linearReload, &t.linearControl, &t.linearStart)
+}
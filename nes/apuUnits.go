@@ -0,0 +1,105 @@
+package nes
+
+// Units shared by several of the APU's channels.
+// reference: https://wiki.nesdev.com/w/index.php/APU
+
+// Length counter loads, indexed by the 5 bits written to a channel's length
+// counter register.
+var lengthTable = [32]byte{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// apuLengthCounter silences its channel once it has counted down to 0. It is
+// clocked by the frame counter's half frames.
+// reference: https://wiki.nesdev.com/w/index.php/APU_Length_Counter
+type apuLengthCounter struct {
+	enabled bool // Set through $4015, a disabled counter is held at 0
+	halt    bool // Stops the counter, shares a bit with the envelope's loop flag
+	counter byte
+}
+
+func (l *apuLengthCounter) setEnabled(enabled bool) {
+	l.enabled = enabled
+	if !enabled {
+		l.counter = 0
+	}
+}
+
+func (l *apuLengthCounter) load(idx byte) {
+	if l.enabled {
+		l.counter = lengthTable[idx&0x1F]
+	}
+}
+
+func (l *apuLengthCounter) clock() {
+	if !l.halt && l.counter > 0 {
+		l.counter--
+	}
+}
+
+func (l *apuLengthCounter) saveState(e *stateEncoder) {
+	e.write(l.enabled, l.halt, l.counter)
+}
+
+func (l *apuLengthCounter) loadState(d *stateDecoder) {
+	d.read(&l.enabled, &l.halt, &l.counter)
+}
+
+// apuEnvelope produces a channel's volume, either constant or a decaying saw
+// wave. It is clocked by the frame counter's quarter frames.
+// reference: https://wiki.nesdev.com/w/index.php/APU_Envelope
+type apuEnvelope struct {
+	start    bool // Restart the decay, set by writing the channel's length counter
+	loop     bool // Restart the decay once it reaches 0
+	constant bool // Output the volume, rather than the decay level
+	volume   byte // Constant volume, also the divider's period
+
+	divider byte
+	decay   byte // Decay level, counts down from 15
+}
+
+// write sets the envelope from the low 6 bits of a channel's first register:
+// --LC VVVV.
+func (env *apuEnvelope) write(data byte) {
+	env.loop = data&0x20 > 0
+	env.constant = data&0x10 > 0
+	env.volume = data & 0x0F
+}
+
+func (env *apuEnvelope) clock() {
+	if env.start {
+		env.start = false
+		env.decay = 15
+		env.divider = env.volume
+		return
+	}
+
+	if env.divider > 0 {
+		env.divider--
+		return
+	}
+
+	env.divider = env.volume
+	if env.decay > 0 {
+		env.decay--
+	} else if env.loop {
+		env.decay = 15
+	}
+}
+
+func (env *apuEnvelope) output() byte {
+	if env.constant {
+		return env.volume
+	}
+
+	return env.decay
+}
+
+func (env *apuEnvelope) saveState(e *stateEncoder) {
+	e.write(env.start, env.loop, env.constant, env.volume, env.divider, env.decay)
+}
+
+func (env *apuEnvelope) loadState(d *stateDecoder) {
+	d.read(&env.start, &env.loop, &env.constant, &env.volume, &env.divider, &env.decay)
+}
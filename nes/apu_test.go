@@ -0,0 +1,478 @@
+package nes
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPulseSweepNegate(t *testing.T) {
+	// Pulse 1 subtracts 1 more than pulse 2 when negating.
+	tests := []struct {
+		channel byte
+		want    uint16
+	}{
+		{1, 0x100 - 0x20 - 1},
+		{2, 0x100 - 0x20},
+	}
+
+	for _, test := range tests {
+		p := newApuPulse(test.channel)
+		p.write(2, 0x00)
+		p.write(3, 0x01) // period $100
+		p.write(1, 0x8B) // enabled, period 0, negate, shift 3
+
+		p.clockSweep()
+		if p.timerPeriod != test.want {
+			t.Errorf("pulse %d: got period %#03X, want %#03X", test.channel, p.timerPeriod, test.want)
+		}
+	}
+}
+
+func TestPulseOutput(t *testing.T) {
+	bus := NewBus(false, false)
+	apu := bus.Apu
+
+	bus.CpuWrite(0x4015, 0x01) // enable pulse 1
+	bus.CpuWrite(0x4000, 0xBF) // 50% duty, halt, constant volume 15
+	bus.CpuWrite(0x4002, 0x10)
+	bus.CpuWrite(0x4003, 0x08) // period $10, length index 1
+
+	p := apu.pulse[0]
+	if p.length.counter != lengthTable[1] {
+		t.Fatalf("got length %d, want %d", p.length.counter, lengthTable[1])
+	}
+
+	// Over a whole sequence the output is high for half of the steps.
+	high := 0
+	for i := 0; i < 8*2*(0x10+1); i++ {
+		apu.Clock()
+		if p.output() == 15 {
+			high++
+		}
+	}
+	if want := 4 * 2 * (0x10 + 1); high != want {
+		t.Errorf("got %d cycles high, want %d", high, want)
+	}
+
+	// Periods below 8 are muted by the sweep unit.
+	bus.CpuWrite(0x4002, 0x07)
+	bus.CpuWrite(0x4003, 0x08)
+	for i := 0; i < 32; i++ {
+		apu.Clock()
+		if p.output() != 0 {
+			t.Fatalf("got output %d with period 7, want 0", p.output())
+		}
+	}
+
+	// Disabling the channel clears its length counter.
+	bus.CpuWrite(0x4015, 0x00)
+	if p.length.counter != 0 {
+		t.Errorf("got length %d after disabling, want 0", p.length.counter)
+	}
+}
+
+func TestEnvelopeDecay(t *testing.T) {
+	var env apuEnvelope
+	env.write(0x01) // decay, period 1
+	env.start = true
+
+	env.clock()
+	if env.output() != 15 {
+		t.Fatalf("got volume %d after start, want 15", env.output())
+	}
+
+	// Decays by 1 every 2 clocks, stopping at 0.
+	for i := 0; i < 2*15; i++ {
+		env.clock()
+	}
+	if env.output() != 0 {
+		t.Errorf("got volume %d, want 0", env.output())
+	}
+	env.clock()
+	env.clock()
+	if env.output() != 0 {
+		t.Errorf("got volume %d without looping, want 0", env.output())
+	}
+}
+
+func TestTriangle(t *testing.T) {
+	bus := NewBus(false, false)
+	tri := bus.Apu.triangle
+
+	bus.CpuWrite(0x4015, 0x04) // enable triangle
+	bus.CpuWrite(0x4008, 0x02) // linear counter 2
+	bus.CpuWrite(0x400A, 0x04)
+	bus.CpuWrite(0x400B, 0x08) // period 4, length index 1
+
+	// The sequencer doesn't step until the linear counter is loaded.
+	for i := 0; i < 20; i++ {
+		bus.Apu.Clock()
+	}
+	if tri.sequence != 0 {
+		t.Fatalf("got step %d before linear counter was loaded, want 0", tri.sequence)
+	}
+
+	bus.Apu.clockQuarterFrame()
+	for i := 0; i < 5*3; i++ {
+		bus.Apu.Clock()
+	}
+	if tri.sequence != 3 {
+		t.Errorf("got step %d, want 3", tri.sequence)
+	}
+
+	// Once the linear counter runs out, the output holds its level.
+	bus.Apu.clockQuarterFrame()
+	bus.Apu.clockQuarterFrame()
+	level := tri.output()
+	for i := 0; i < 20; i++ {
+		bus.Apu.Clock()
+	}
+	if tri.output() != level {
+		t.Errorf("got level %d after linear counter ran out, want %d", tri.output(), level)
+	}
+
+	// Ultrasonic periods stop the sequencer.
+	bus.CpuWrite(0x400A, 0x01)
+	bus.CpuWrite(0x400B, 0x08)
+	bus.Apu.clockQuarterFrame()
+	step := tri.sequence
+	for i := 0; i < 20; i++ {
+		bus.Apu.Clock()
+	}
+	if tri.sequence != step {
+		t.Errorf("got step %d with period 1, want %d", tri.sequence, step)
+	}
+}
+
+func TestNoiseLfsr(t *testing.T) {
+	// The LFSR repeats every 32767 steps in long mode, 93 in short mode.
+	tests := []struct {
+		mode byte
+		want int
+	}{
+		{0x00, 32767},
+		{0x80, 93},
+	}
+
+	for _, test := range tests {
+		n := newApuNoise()
+		n.write(2, test.mode) // shortest period, 4 CPU cycles
+		n.clockTimer()        // load the timer
+
+		start := n.shift
+		steps := 0
+		for {
+			for i := 0; i < 4; i++ {
+				n.clockTimer()
+			}
+			steps++
+			if n.shift == start || steps > 40000 {
+				break
+			}
+		}
+		if steps != test.want {
+			t.Errorf("mode %#02X: got period %d, want %d", test.mode, steps, test.want)
+		}
+	}
+}
+
+func TestDmcFetch(t *testing.T) {
+	console := newTestConsole(t, testProgram)
+	bus := console.Bus()
+	dmc := bus.Apu.dmc
+
+	bus.CpuWrite(0x4010, 0x8F) // IRQ enabled, fastest rate
+	bus.CpuWrite(0x4012, 0x00) // $C000, mirrors $8000 with 16KB PRG ROM
+	bus.CpuWrite(0x4013, 0x00) // 1 byte
+	bus.CpuWrite(0x4015, 0x10) // start
+
+	// The fetch stalls the CPU for 4 cycles.
+	stalled := 0
+	for i := 0; i < 3*20; i++ {
+		if bus.ClockCount%3 == 0 && bus.dmcStall > 0 {
+			stalled++
+		}
+		bus.Clock()
+	}
+	if stalled != dmcStallCycles {
+		t.Errorf("got %d stalled cycles, want %d", stalled, dmcStallCycles)
+	}
+	if dmc.bufferEmpty && dmc.silence {
+		t.Fatalf("sample byte not fetched")
+	}
+	if !dmc.irq {
+		t.Errorf("IRQ flag not set after the sample finished")
+	}
+
+	// Finish the current output cycle, picking up the sample byte.
+	for !dmc.bufferEmpty {
+		dmc.clockOutput()
+	}
+
+	// The sample byte ($A9, LDA) moves the output level up for 1 bits and
+	// down for 0 bits, starting from the least significant bit.
+	bus.CpuWrite(0x4011, 0x40)
+	want := []byte{0x42, 0x40, 0x3E, 0x40, 0x3E, 0x40, 0x3E, 0x40}
+	for i, w := range want {
+		dmc.clockOutput()
+		if dmc.level != w {
+			t.Errorf("bit %d: got level %#02X, want %#02X", i, dmc.level, w)
+		}
+	}
+}
+
+func TestFrameCounter(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         byte
+		wantQuarters int
+		wantHalves   int
+		wantIrq      bool
+	}{
+		{"4-step", 0x00, 4, 2, true},
+		{"4-step, IRQ inhibited", 0x40, 4, 2, false},
+		{"5-step", 0x80, 4 + 1, 2 + 1, false}, // plus 1 when the sequence starts
+	}
+
+	for _, test := range tests {
+		apu := NewApu()
+		apu.cpuWrite(0x4017, test.data)
+
+		quarters, halves := 0, 0
+		for i := 0; i < 4+int(frameStepsNTSC[4]); i++ {
+			q, h := apu.frameCounter.clock()
+			if q {
+				quarters++
+			}
+			if h {
+				halves++
+			}
+			if apu.frameCounter.cycle == 0 && i > 4 {
+				break
+			}
+		}
+
+		if quarters != test.wantQuarters || halves != test.wantHalves {
+			t.Errorf("%s: got %d quarter and %d half frames, want %d and %d",
+				test.name, quarters, halves, test.wantQuarters, test.wantHalves)
+		}
+		if apu.frameCounter.irq != test.wantIrq {
+			t.Errorf("%s: got IRQ %v, want %v", test.name, apu.frameCounter.irq, test.wantIrq)
+		}
+
+		// Reading $4015 acknowledges the interrupt.
+		status := apu.cpuRead(0x4015)
+		if (status&0x40 > 0) != test.wantIrq || apu.frameCounter.irq {
+			t.Errorf("%s: got status %#02X, IRQ %v after read", test.name, status, apu.frameCounter.irq)
+		}
+	}
+}
+
+func TestFrameIrq(t *testing.T) {
+	// Enables interrupts and loops, counting frame interrupts in $20:
+	//
+	//	$8000: CLI
+	//	$8001: JMP $8001
+	//	$8010: LDA $4015 ; acknowledge
+	//	       INC $20
+	//	       RTI
+	program := make([]byte, 0x20)
+	copy(program, []byte{0x58, 0x4C, 0x01, 0x80})
+	copy(program[0x10:], []byte{0xAD, 0x15, 0x40, 0xE6, 0x20, 0x40})
+
+	for _, inhibit := range []bool{false, true} {
+		rom := newTestRom(program)
+		rom[16+0x3FFE] = 0x10 // IRQ vector -> $8010
+		rom[16+0x3FFF] = 0x80
+
+		console := NewConsole()
+		if err := console.LoadROM(writeTestRom(t, rom)); err != nil {
+			t.Fatal(err)
+		}
+		if inhibit {
+			console.Bus().CpuWrite(0x4017, 0x40)
+		}
+
+		// Interrupts every 29830 CPU cycles, about 1.002 frames.
+		for i := 0; i < 3; i++ {
+			console.RunFrame()
+		}
+
+		want := byte(2)
+		if inhibit {
+			want = 0
+		}
+		if got := console.Bus().Ram[0x20]; got != want {
+			t.Errorf("inhibit %v: got %d interrupts, want %d", inhibit, got, want)
+		}
+	}
+}
+
+func TestAudioOutput(t *testing.T) {
+	const sampleRate = 48000
+
+	for _, enabled := range []bool{false, true} {
+		console := newTestConsole(t, testProgram)
+		audio := NewAudioBuffer(sampleRate)
+		console.ConnectAudioSink(audio)
+
+		if enabled {
+			// Pulse 1, 50% duty, constant volume, at 1789773 / (16 * 254) ~ 440Hz
+			bus := console.Bus()
+			bus.CpuWrite(0x4015, 0x01)
+			bus.CpuWrite(0x4000, 0xBF)
+			bus.CpuWrite(0x4002, 0xFD)
+			bus.CpuWrite(0x4003, 0x08)
+		}
+
+		const frames = 30
+		for i := 0; i < frames; i++ {
+			console.RunFrame()
+		}
+
+		// About 1/60th of a second of audio per frame.
+		want := sampleRate * frames / 60
+		if got := len(audio.Samples); got < want*99/100 || got > want*101/100 {
+			t.Fatalf("got %d samples, want ~%d", got, want)
+		}
+
+		// Skip the first few frames while the filters settle.
+		samples := audio.Samples[len(audio.Samples)/3:]
+		peak := float32(0)
+		for _, s := range samples {
+			if s > peak {
+				peak = s
+			}
+		}
+
+		// Count the high-pass filtered wave's swings between positive and
+		// negative, 2 per cycle, ignoring small ripples around 0.
+		crossings := 0
+		high := samples[0] > 0
+		for _, s := range samples {
+			if high && s < -peak/2 || !high && s > peak/2 {
+				high = !high
+				crossings++
+			}
+		}
+
+		if !enabled {
+			if peak > 0.001 {
+				t.Errorf("got peak %f with every channel silent, want ~0", peak)
+			}
+			continue
+		}
+
+		seconds := float64(len(samples)) / sampleRate
+		freq := float64(crossings) / 2 / seconds
+		if freq < 430 || freq > 450 {
+			t.Errorf("got frequency %.1fHz, want ~440Hz", freq)
+		}
+		if peak < 0.05 || peak > 1 {
+			t.Errorf("got peak %f, want a clearly audible wave", peak)
+		}
+	}
+}
+
+func TestBlipBuffer(t *testing.T) {
+	// A single step settles at its full height, without ringing forever.
+	var bb blipBuffer
+	bb.setRates(1000, 100)
+	for i := 0; i < 5; i++ {
+		bb.clock()
+	}
+	bb.addDelta(1)
+	for i := 0; i < 500; i++ {
+		bb.clock()
+	}
+
+	samples := bb.readSamples(nil)
+	if len(samples) != 50 {
+		t.Fatalf("got %d samples, want 50", len(samples))
+	}
+	if got := samples[len(samples)-1]; math.Abs(float64(got)-1) > 1e-5 {
+		t.Errorf("got final level %f, want 1", got)
+	}
+	if got := samples[0]; math.Abs(float64(got)) > 1e-5 {
+		t.Errorf("got initial level %f, want 0", got)
+	}
+}
+
+func TestChannelControls(t *testing.T) {
+	apu := NewApu()
+	levels := [NumAudioChannels]float32{
+		ChannelPulse1:   15,
+		ChannelPulse2:   8,
+		ChannelTriangle: 12,
+		ChannelNoise:    6,
+		ChannelDmc:      100,
+	}
+
+	// The formulas match the lookup tables.
+	unity := apu.output(&levels)
+	apu.SetChannelVolume(ChannelNoise, 1.5)
+	apu.SetChannelVolume(ChannelNoise, 1)
+	if apu.controls.unity {
+		if got := mixChannelsGain(&levels, &apu.controls.gains); math.Abs(float64(got-unity)) > 1e-6 {
+			t.Errorf("got mix %f from formulas, want %f", got, unity)
+		}
+	} else {
+		t.Errorf("gains not back to unity after resetting volume")
+	}
+
+	// Only pulse 1 left.
+	only := [NumAudioChannels]float32{ChannelPulse1: 15}
+	want := apu.output(&only)
+
+	for ch := AudioChannel(0); int(ch) < NumAudioChannels; ch++ {
+		apu.SetChannelMuted(ch, ch != ChannelPulse1)
+	}
+	if got := apu.output(&levels); math.Abs(float64(got-want)) > 0.001 {
+		t.Errorf("muted: got %f, want %f", got, want)
+	}
+
+	for ch := AudioChannel(0); int(ch) < NumAudioChannels; ch++ {
+		apu.SetChannelMuted(ch, false)
+	}
+	apu.SetChannelSolo(ChannelPulse1, true)
+	if got := apu.output(&levels); math.Abs(float64(got-want)) > 0.001 {
+		t.Errorf("solo: got %f, want %f", got, want)
+	}
+
+	// Muting a soloed channel silences everything.
+	apu.SetChannelMuted(ChannelPulse1, true)
+	if got := apu.output(&levels); got != 0 {
+		t.Errorf("muted solo: got %f, want 0", got)
+	}
+
+	apu.SetChannelVolume(ChannelPulse1, 5)
+	if got := apu.ChannelVolume(ChannelPulse1); got != maxChannelVolume {
+		t.Errorf("got volume %f, want %f", got, maxChannelVolume)
+	}
+}
+
+func TestChannelLevels(t *testing.T) {
+	bus := NewBus(false, false)
+	bus.Apu.SetLevelMetering(true)
+
+	bus.CpuWrite(0x4015, 0x01)
+	bus.CpuWrite(0x4000, 0xB8) // constant volume 8
+	bus.CpuWrite(0x4002, 0x10)
+	bus.CpuWrite(0x4003, 0x08)
+	for i := 0; i < 1000; i++ {
+		bus.Apu.Clock()
+	}
+
+	levels := bus.Apu.ChannelLevels()
+	if want := float32(8) / 15; levels[ChannelPulse1] != want {
+		t.Errorf("got pulse 1 level %f, want %f", levels[ChannelPulse1], want)
+	}
+	if levels[ChannelNoise] != 0 {
+		t.Errorf("got noise level %f, want 0", levels[ChannelNoise])
+	}
+
+	// Reading the levels resets them.
+	if levels := bus.Apu.ChannelLevels(); levels[ChannelPulse1] != 0 {
+		t.Errorf("got pulse 1 level %f after reading, want 0", levels[ChannelPulse1])
+	}
+}
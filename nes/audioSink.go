@@ -0,0 +1,72 @@
+package nes
+
+// AudioSink receives the mixed and filtered output of the APU. The speaker
+// package's Speaker plays it through the computer's sound card, AudioBuffer is
+// an in-memory one for tests and headless use.
+type AudioSink interface {
+	// SampleRate returns the number of samples per second the sink expects,
+	// e.g. 44100 or 48000.
+	SampleRate() int
+
+	// WriteSamples is called with each batch of mono samples, ranging from
+	// -1 to 1. The slice is reused once WriteSamples returns.
+	WriteSamples(samples []float32)
+}
+
+// Sample rate of audio recorded without an AudioSink, see Bus.RecordWav.
+const defaultSampleRate int = 44100
+
+// AudioBuffer is a headless AudioSink, storing every sample written to it.
+type AudioBuffer struct {
+	rate int
+
+	Samples []float32 // All samples written so far
+}
+
+func NewAudioBuffer(sampleRate int) *AudioBuffer {
+	return &AudioBuffer{
+		rate: sampleRate,
+	}
+}
+
+func (a *AudioBuffer) SampleRate() int {
+	return a.rate
+}
+
+func (a *AudioBuffer) WriteSamples(samples []float32) {
+	a.Samples = append(a.Samples, samples...)
+}
+
+// audioTee is an AudioSink writing to several sinks, all at the sample rate
+// of the first.
+type audioTee []AudioSink
+
+// teeAudioSinks returns a sink writing to each of the given non-nil sinks, or
+// nil if there are none.
+func teeAudioSinks(sinks ...AudioSink) AudioSink {
+	var tee audioTee
+	for _, s := range sinks {
+		if s != nil {
+			tee = append(tee, s)
+		}
+	}
+
+	switch len(tee) {
+	case 0:
+		return nil
+	case 1:
+		return tee[0]
+	}
+
+	return tee
+}
+
+func (t audioTee) SampleRate() int {
+	return t[0].SampleRate()
+}
+
+func (t audioTee) WriteSamples(samples []float32) {
+	for _, s := range t {
+		s.WriteSamples(samples)
+	}
+}
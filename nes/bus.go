@@ -5,18 +5,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"time"
+	"os"
+	"strings"
 )
 
 // Main bus used by the CPU.
 type Bus struct {
 	Cpu             *Cpu6502       // NES CPU.
 	Ppu             *Ppu           // Picture processing unit.
+	Apu             *Apu           // Audio processing unit.
 	Ram             [8 * 1024]byte // 8KiB RAM.
 	Cart            *Cartridge     // NES Cartridge.
 	Controller      [2]*Controller // NES Controller.
 	ControllerState [2]byte        // 8 bit shifter representing each button's state
-	Disp            *Display
 
 	ClockCount int
 
@@ -28,6 +29,15 @@ type Bus struct {
 	dmaTransfer bool // Set to enable DMA transfer
 	dmaNeedSync bool // Set when CPU should wait 1 cycle for DMA
 
+	dmcStall int // CPU cycles left in a DMC sample fetch
+
+	openBus byte // Last value on the data bus, read from unmapped addresses
+
+	rewind *rewindBuffer // Recent snapshots, for running the game backwards
+
+	audio    AudioSink  // Plays the APU's output, see ConnectAudioSink
+	recorder *WavWriter // Records the APU's output, if set
+
 	isDebug   bool // Enable debug panel
 	isLogging bool // Enable logging
 }
@@ -43,9 +53,16 @@ const (
 	ppuMaxAddr uint16 = 0x3FFF
 	ppuMirror  uint16 = 0x0007 // mirror every 8 bytes.
 
-	// Cartridge
-	cartMinAddr uint16 = 0x8000 // XXX: changing this for now to get disassembler to work
-	cartMaxAddr uint16 = 0xFFFF
+	// Cartridge, mapped by the cartridge's mapper
+	cartMinAddr   uint16 = 0x4020
+	cartMaxAddr   uint16 = 0xFFFF
+	prgRamMinAddr uint16 = 0x6000 // Cartridge work RAM, battery backed on some cartridges.
+	prgRamMaxAddr uint16 = 0x7FFF
+	prgRomMinAddr uint16 = 0x8000
+
+	// APU
+	apuMinAddr uint16 = 0x4000
+	apuMaxAddr uint16 = 0x4013
 
 	// Direct memory access
 	dmaAddr uint16 = 0x4014
@@ -54,8 +71,8 @@ const (
 	ctrlMinAddr uint16 = 0x4016
 	ctrlMaxAddr uint16 = 0x4017
 
-	// Frames per second
-	fps float64 = 60
+	// Frames between writing battery backed RAM to disk (~5 seconds).
+	batterySaveFrames int = 300
 )
 
 func NewBus(isDebug, isLogging bool) *Bus {
@@ -71,10 +88,13 @@ func NewBus(isDebug, isLogging bool) *Bus {
 	bus := &Bus{
 		Cpu:         cpu,
 		Ppu:         NewPpu(),
+		Apu:         NewApu(),
 		Controller:  controllers,
 		dmaTransfer: false,
 		dmaNeedSync: true,
 
+		rewind: newRewindBuffer(rewindInterval, rewindCapacity),
+
 		isDebug:   isDebug,
 		isLogging: isLogging,
 	}
@@ -85,71 +105,172 @@ func NewBus(isDebug, isLogging bool) *Bus {
 	return bus
 }
 
-// Run the NES.
-func (b *Bus) Run() {
-	// Create a PixelGL display for the PPU to render to.
-	display := NewDisplay(b.isDebug)
-	b.Disp = display
-
-	// PPU needs access to the display.
-	b.Ppu.ConnectDisplay(display)
-
-	intervalInMilli := (1 / fps) * 1000
-	interval := time.Duration(intervalInMilli) * time.Millisecond
-	fmt.Println("Frame refresh time:", interval)
-
-	// Use a timer to keep frames rendered steadily at a set FPS.
-	var t time.Time
-	for !display.window.Closed() {
-		// Run 1 whole frame.
-		t = time.Now()
-		for !b.Ppu.frameComplete {
-			b.Clock()
-		}
+// ConnectAudioSink sets the sink that audio is written to, such as the
+// speaker package's Speaker. Audio is only mixed once a sink is connected.
+func (b *Bus) ConnectAudioSink(s AudioSink) {
+	b.audio = s
+	b.connectAudio()
+}
 
-		for i := range b.Controller {
-			b.Controller[i].updateControllerInput(b.Disp.window)
-		}
+// connectAudio connects the APU to the bus's audio sink and WAV recorder.
+func (b *Bus) connectAudio() {
+	if b.recorder != nil {
+		b.Apu.ConnectAudioSink(teeAudioSinks(b.audio, b.recorder))
+	} else {
+		b.Apu.ConnectAudioSink(b.audio)
+	}
+}
 
-		if b.isDebug {
-			b.DrawDebugPanel()
-		}
+// RecordWav starts recording the APU's output to a WAV file at the given path,
+// until StopRecording is called. Audio is recorded at the audio sink's sample
+// rate, or 44.1kHz without one.
+func (b *Bus) RecordWav(path string) error {
+	err := b.StopRecording()
+	if err != nil {
+		return err
+	}
+
+	sampleRate := defaultSampleRate
+	if b.audio != nil {
+		sampleRate = b.audio.SampleRate()
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
 
-		since := time.Since(t)
-		toSleep := interval - since
-		time.Sleep(toSleep)
+	b.recorder, err = NewWavWriter(f, sampleRate)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	b.connectAudio()
+
+	return nil
+}
 
-		// Prepare for new frame
-		b.Ppu.frameComplete = false
+// StopRecording finishes the WAV recording started by RecordWav, if any.
+func (b *Bus) StopRecording() error {
+	if b.recorder == nil {
+		return nil
+	}
+
+	// Write out the last few samples mixed.
+	b.Apu.mixer.flush()
+
+	err := b.recorder.Close()
+	b.recorder = nil
+	b.connectAudio()
+
+	return err
+}
+
+// RunFrame clocks the NES until the PPU has completed 1 whole frame, taking
+// rewind snapshots as it goes.
+func (b *Bus) RunFrame() {
+	b.clockFrame()
+	b.rewind.frame(b)
+}
+
+// clockFrame clocks the NES until the PPU has completed 1 whole frame.
+func (b *Bus) clockFrame() {
+	for !b.Ppu.frameComplete {
+		b.Clock()
+	}
+
+	// Prepare for new frame
+	b.Ppu.frameComplete = false
+
+	// Periodically save battery backed RAM.
+	if b.Ppu.frames%batterySaveFrames == 0 {
+		b.flushCartridge()
+	}
+}
+
+// IsDebug returns whether the bus was created for the debug panel, recording
+// the CPU's recent instructions.
+func (b *Bus) IsDebug() bool {
+	return b.isDebug
+}
+
+// Close saves the cartridge's battery backed RAM to its .sav file, and
+// finishes any WAV recording.
+func (b *Bus) Close() error {
+	err := b.StopRecording()
+	if err != nil {
+		return err
+	}
+
+	if b.Cart == nil {
+		return nil
+	}
+
+	return b.Cart.Flush()
+}
+
+// flushCartridge writes the cartridge's battery backed RAM to disk.
+func (b *Bus) flushCartridge() {
+	if b.Cart == nil {
+		return
+	}
+
+	err := b.Cart.Flush()
+	if err != nil {
+		log.Printf("Unable to save battery backed RAM\n%v\n", err)
 	}
 }
 
 // Used by the CPU to read data from the main bus at a specified address.
+// Addresses nothing responds to read the last value on the data bus.
 func (b *Bus) CpuRead(addr uint16) byte {
-	var data byte
+	data := b.openBus
 
 	if addr >= ramMinAddr && addr <= ramMaxAddr {
 		data = b.Ram[addr&ramMirror]
 	} else if addr >= ppuMinAddr && addr <= ppuMaxAddr {
 		data = b.Ppu.cpuRead(addr & ppuMirror)
 	} else if addr >= cartMinAddr && addr <= cartMaxAddr {
-		data = b.Cart.cpuRead(addr)
+		if b.Cart != nil {
+			if cartData, ok := b.Cart.cpuRead(addr); ok {
+				data = cartData
+			}
+		}
+	} else if addr == apuStatusAddr {
+		data = b.Apu.cpuRead(addr)
 	} else if addr >= ctrlMinAddr && addr <= ctrlMaxAddr {
 		data = (b.ControllerState[addr&1] & (1 << 7)) >> 7
 		b.ControllerState[addr&1] <<= 1 // shift
 	}
 
+	b.openBus = data
+
 	return data
 }
 
 // Used by the CPU to write data to the main bus at a specified address.
 func (b *Bus) CpuWrite(addr uint16, data byte) {
+	b.openBus = data
+
 	if addr >= ramMinAddr && addr <= ramMaxAddr {
 		b.Ram[addr&ramMirror] = data
 	} else if addr >= ppuMinAddr && addr <= ppuMaxAddr {
 		b.Ppu.cpuWrite(addr&ppuMirror, data)
+
+		// Cartridges see the writes too, some mappers watch the PPU's
+		// registers.
+		if b.Cart != nil {
+			b.Cart.cpuWrite(addr, data)
+		}
 	} else if addr >= cartMinAddr && addr <= cartMaxAddr {
-		b.Cart.cpuWrite(addr, data)
+		if b.Cart != nil {
+			b.Cart.cpuWrite(addr, data)
+		}
+	} else if (addr >= apuMinAddr && addr <= apuMaxAddr) || addr == apuStatusAddr ||
+		addr == apuFrameAddr {
+		// $4017 writes go to the APU frame counter, only $4016 writes reach
+		// the controllers.
+		b.Apu.cpuWrite(addr, data)
 	} else if addr == dmaAddr {
 		b.dmaPage = data
 		b.dmaAddr = 0x00
@@ -165,11 +286,20 @@ func (b *Bus) CpuWrite(addr uint16, data byte) {
 func (b *Bus) InsertCartridge(cart *Cartridge) {
 	b.Cart = cart
 	b.Ppu.ConnectCartridge(cart)
+
+	// Powering on replaces the cartridge's mapper.
+	cart.powerOn()
+	b.Apu.connectExpansion(cart.mapper)
+	b.Apu.setTiming(cart.Info.Timing)
+
+	// Snapshots of the previous cartridge can't be rewound to.
+	b.rewind.clear()
 }
 
 // Reset the NES.
 func (b *Bus) Reset() {
 	b.Cpu.Reset()
+	b.Apu.Reset()
 
 	b.ClockCount = 0
 }
@@ -180,12 +310,28 @@ func (b *Bus) Clock() {
 
 	// CPU runs 3 times slower than PPU.
 	if b.ClockCount%3 == 0 {
-		if b.dmaTransfer {
+		if b.dmcStall > 0 {
+			// A DMC sample fetch suspends the CPU, and any DMA transfer
+			b.initDmcTransfer()
+		} else if b.dmaTransfer {
 			// A DMA transfer suspends the CPU until complete
 			b.initDmaTransfer()
 		} else {
 			b.Cpu.Clock()
 		}
+
+		b.Apu.Clock()
+		if b.Cart != nil {
+			b.Cart.cpuClock()
+		}
+		if b.dmcStall == 0 && b.Apu.dmc.needsSample() {
+			b.dmcStall = dmcStallCycles
+		}
+
+		// Interrupt requests are checked between instructions.
+		if b.irqPending() && b.Cpu.Cycles == 0 && !b.dmaTransfer && b.dmcStall == 0 {
+			b.Cpu.IRQ()
+		}
 	}
 
 	if b.Ppu.nmi {
@@ -220,31 +366,52 @@ func (b *Bus) initDmaTransfer() {
 	}
 }
 
-// TODO: move this out of Bus, and into main or something. Also, rewrite this.
-func (b *Bus) DrawDebugPanel() {
-	// Pattern tables
-	patternTable0 := b.Ppu.GetPatternTable(0)
-	patternTable1 := b.Ppu.GetPatternTable(1)
+// irqPending returns whether any device is asserting the CPU's IRQ line.
+func (b *Bus) irqPending() bool {
+	return b.Apu.irq() || (b.Cart != nil && b.Cart.irq())
+}
+
+// The DMC fetches its next sample byte from CPU memory, stalling the CPU for
+// a few cycles. The byte is read on the last cycle.
+func (b *Bus) initDmcTransfer() {
+	b.dmcStall--
+	if b.dmcStall == 0 {
+		b.Apu.dmc.fill(b.CpuRead(b.Apu.dmc.currentAddr))
+	}
+}
+
+// AudioDebugString returns a level meter for each audio channel, along with
+// its mute, solo and volume settings, for the debug panel.
+func (b *Bus) AudioDebugString() string {
+	const meterWidth = 10
 
-	b.Disp.DrawDebugRGBA(8, int(gameH)-128-8, patternTable0)
-	b.Disp.DrawDebugRGBA(128+16, int(gameH)-128-8, patternTable1)
+	var buf bytes.Buffer
+	buf.WriteString("Audio levels:\n")
 
-	b.Disp.debugRegText.Clear()
-	debugStr := b.getCpuDebugString()
-	b.Disp.WriteRegDebugString(debugStr)
+	levels := b.Apu.ChannelLevels()
+	for i, level := range levels {
+		ch := AudioChannel(i)
+		bars := int(level*meterWidth + 0.5)
 
-	// Keyboard input
-	contDebugStr := fmt.Sprintf("Controller status:\n%08b\n\n%08b", b.ControllerState[0], b.ControllerState[1])
-	b.Disp.WriteControllerDebugString(contDebugStr)
+		flags := ""
+		if b.Apu.ChannelMuted(ch) {
+			flags += " M"
+		}
+		if b.Apu.ChannelSolo(ch) {
+			flags += " S"
+		}
+
+		fmt.Fprintf(&buf, "%-9s %s%s %3.0f%%%s\n", ch,
+			strings.Repeat("#", bars), strings.Repeat(".", meterWidth-bars),
+			100*b.Apu.ChannelVolume(ch), flags)
+	}
 
-	// Disassembly
-	diss := b.getDisassemblyLines()
-	b.Disp.WriteInstDebugString(diss)
+	return buf.String()
 }
 
-// getDisassemblyLines returns the last 15 lines of disassembly, separated by
-// new lines, as a string.
-func (b *Bus) getDisassemblyLines() string {
+// DisassemblyLines returns the last 15 lines of disassembly, separated by
+// new lines, as a string. Instructions are only recorded in debug mode.
+func (b *Bus) DisassemblyLines() string {
 	var buf bytes.Buffer
 
 	idx := b.Cpu.PrevInstIdx
@@ -261,7 +428,8 @@ func (b *Bus) getDisassemblyLines() string {
 	return buf.String()
 }
 
-func (b *Bus) getCpuDebugString() string {
+// CpuDebugString returns the CPU's registers, for the debug panel.
+func (b *Bus) CpuDebugString() string {
 	var buf bytes.Buffer
 
 	buf.WriteString(fmt.Sprintf("Flags: %08b\n", b.Cpu.Status))
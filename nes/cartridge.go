@@ -1,25 +1,50 @@
 package nes
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/sha1"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 // NES Cartridge. Connected to both main bus and PPU bus.
 // The cartridges consist of program (PRG) memory and character (CHR) memory.
 type Cartridge struct {
 	prgMem []byte // Program memory (PRG)
-	chrMem []byte // Character memory (CHR)
+	chrMem []byte // Character memory (CHR), either ROM or RAM
+	prgRam []byte // Work RAM mapped to $6000-$7FFF, battery backed on some cartridges
+
+	chrIsRam bool // Whether chrMem is writable CHR RAM
+
+	trainer []byte // Optional 512 bytes copied to $7000-$71FF at power on
+
+	prgRamDirty bool // Set when PRG RAM has been written to since the last save
+
+	// Path of the .sav file used to persist battery backed PRG RAM. Set by
+	// NewCartridge when the cartridge has a battery.
+	SavePath string
+
+	romPath string            // Path of the ROM file, if loaded by NewCartridge
+	hash    [romHashSize]byte // Identifies the ROM, see Hash
 
 	mapper Mapper // Cartridge mapper used to configure CPU/PPU read/write addresses.
 
-	mirroring MirrorMode
+	mirroring     MirrorMode
+	fourScreenRam []byte // Extra 2KB of nametable memory for four-screen mirroring
+
+	Info CartridgeInfo // Cartridge details decoded from the file header.
 }
 
-// iNES file header
+// iNES file header. NES 2.0 headers reinterpret flags 8-10 and the padding,
+// see parseNes20Header.
 // reference: https://wiki.nesdev.com/w/index.php/INES
 type CartridgeHeader struct {
 	Name         [4]byte // Constant "NES" followed by MS-DOS end of file
@@ -33,109 +58,325 @@ type CartridgeHeader struct {
 	Unused       [5]byte // Unused padding
 }
 
-// Creates a new NES Cartridge using the file at the given path.
-func NewCartridge(filepath string) *Cartridge {
-	// Load the NES file.
-	data, err := ioutil.ReadFile(filepath)
+// Errors returned when loading a cartridge.
+var (
+	ErrBadMagic          = errors.New("nes: not an iNES file")
+	ErrBadSize           = errors.New("nes: invalid ROM size")
+	ErrTruncatedHeader   = errors.New("nes: truncated iNES header")
+	ErrTruncatedTrainer  = errors.New("nes: truncated trainer")
+	ErrTruncatedPrgRom   = errors.New("nes: truncated PRG ROM")
+	ErrTruncatedChrRom   = errors.New("nes: truncated CHR ROM")
+	ErrUnsupportedMapper = errors.New("nes: unsupported mapper")
+)
+
+// iNES file identifier: "NES" followed by MS-DOS end of file.
+var inesMagic = [4]byte{'N', 'E', 'S', 0x1A}
+
+const (
+	trainerSize int    = 512
+	trainerAddr uint16 = 0x7000 // CPU address the trainer is loaded to
+
+	romHashSize int = sha1.Size
+)
+
+// UnsupportedMapperError is returned when a cartridge uses a mapper that has
+// not been implemented.
+type UnsupportedMapperError struct {
+	MapperId int
+}
+
+func (e *UnsupportedMapperError) Error() string {
+	return fmt.Sprintf("%v: %d", ErrUnsupportedMapper, e.MapperId)
+}
+
+func (e *UnsupportedMapperError) Unwrap() error {
+	return ErrUnsupportedMapper
+}
+
+// Creates a new NES Cartridge using the file at the given path. Battery backed
+// PRG RAM is loaded from the .sav file next to the ROM file, if there is one.
+func NewCartridge(filepath string) (*Cartridge, error) {
+	f, err := os.Open(filepath)
 	if err != nil {
-		log.Fatalf("Unable to open %v\n%v\n", filepath, err)
+		return nil, err
 	}
-	fmt.Printf("Header data: % x\n", data[:16])
-	buf := bytes.NewBuffer(data)
+	defer f.Close()
 
-	// Read/decode the NES header.
-	header := new(CartridgeHeader)
-	err = binary.Read(buf, binary.BigEndian, header)
+	cartridge, err := LoadCartridge(bufio.NewReader(f))
 	if err != nil {
-		log.Fatalf("Unable to parse header\n%v\n", err)
+		return nil, err
 	}
-	fmt.Printf("Parsed cartridge header: %+v\n", header)
+	cartridge.romPath = filepath
 
-	// Check if trainer is used (bit 3 of mapper1 flags).
-	if (header.Mapper1 & (0x1 << 3)) > 0 {
-		// 512-byte trainer
-		// XXX: ignoring trainer data for now
-		err = binary.Read(buf, binary.BigEndian, make([]byte, 512))
+	if cartridge.Info.Battery {
+		cartridge.SavePath = savePathFor(filepath)
+		err = cartridge.loadSaveFile()
 		if err != nil {
-			log.Fatalf("Unable to read trainer data\n%v\n", err)
+			return nil, err
 		}
 	}
 
-	// TODO: determine iNES version (0/1/2)
+	return cartridge, nil
+}
 
-	cartridge := new(Cartridge)
+// LoadCartridge creates a new NES Cartridge from the iNES data read from r.
+func LoadCartridge(r io.Reader) (*Cartridge, error) {
+	// Read/decode the NES header.
+	header := new(CartridgeHeader)
+	err := binary.Read(r, binary.BigEndian, header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTruncatedHeader, err)
+	}
+	if header.Name != inesMagic {
+		return nil, ErrBadMagic
+	}
 
-	// Determine mapper ID from high 4 bits of mapper flags.
-	mapperLo := header.Mapper1 >> 4
-	mapperHi := header.Mapper2 >> 4
-	mapperId := (mapperHi << 4) | mapperLo
+	info, err := parseHeader(header)
+	if err != nil {
+		return nil, err
+	}
 
-	// Set Mapper
-	var mapper Mapper
-	switch mapperId {
-	case 0:
-		mapper = NewMapper000(header.PrgRomChunks, header.ChrRomChunks)
+	cartridge := &Cartridge{
+		Info: info,
 	}
-	if mapper == nil {
-		log.Fatal("No suitable mapper found for this ROM file.")
+
+	// Check if trainer is used (bit 2 of mapper1 flags).
+	if info.Trainer {
+		// 512-byte trainer, loaded to $7000-$71FF at power on.
+		cartridge.trainer = make([]byte, trainerSize)
+		_, err = io.ReadFull(r, cartridge.trainer)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTruncatedTrainer, err)
+		}
 	}
-	cartridge.mapper = mapper
-	fmt.Println("Mapper ID:", mapperId)
-	fmt.Println("Mapper:", mapper)
 
-	// Read/load PRG memory (16KB chunks).
-	cartridge.prgMem = make([]byte, 16*1024*int(header.PrgRomChunks))
-	fmt.Printf("PRG ROM size: %v\n", len(cartridge.prgMem))
-	err = binary.Read(buf, binary.BigEndian, cartridge.prgMem)
-	if err != nil {
-		log.Fatalf("Unable to read PRG memory\n%v\n", err)
+	// The mapper is created once the cartridge's memory is loaded.
+	newMapper, ok := mapperRegistry[info.MapperId]
+	if !ok {
+		return nil, &UnsupportedMapperError{info.MapperId}
 	}
 
-	// Read/load CHR memory (8KB chunks).
-	cartridge.chrMem = make([]byte, 8*1024*int(header.ChrRomChunks))
-	fmt.Printf("CHR ROM size: %v\n", len(cartridge.chrMem))
-	err = binary.Read(buf, binary.BigEndian, cartridge.chrMem)
+	// Read/load PRG memory.
+	cartridge.prgMem = make([]byte, info.PrgRomSize)
+	_, err = io.ReadFull(r, cartridge.prgMem)
 	if err != nil {
-		log.Fatalf("Unable to read CHR memory\n%v\n", err)
+		return nil, fmt.Errorf("%w: %v", ErrTruncatedPrgRom, err)
 	}
 
-	// TODO: determine and set mirroring mode
-
-	// Determine if PlayChoice INST-ROM (bit 2 of mapper2 flags).
-	if (header.Mapper2 & (0x1 << 2)) > 0 {
-		// 8192-bytes
-		// XXX: ignoring INST-ROM data for now
-		err = binary.Read(buf, binary.BigEndian, make([]byte, 8192))
+	// Read/load CHR memory. Cartridges without CHR ROM use CHR RAM instead,
+	// 8KB unless the header declares otherwise.
+	if info.ChrRomSize > 0 {
+		cartridge.chrMem = make([]byte, info.ChrRomSize)
+		_, err = io.ReadFull(r, cartridge.chrMem)
 		if err != nil {
-			log.Fatalf("Unable to read PlayChoice INST-ROM data\n%v\n", err)
+			return nil, fmt.Errorf("%w: %v", ErrTruncatedChrRom, err)
 		}
+	} else {
+		chrRamSize := info.ChrRamSize + info.ChrNvramSize
+		if chrRamSize == 0 {
+			chrRamSize = 8 * 1024
+		}
+		cartridge.chrMem = make([]byte, chrRamSize)
+		cartridge.chrIsRam = true
+	}
+
+	// Hash of PRG and CHR ROM, used to match save states to their ROM.
+	hash := sha1.New()
+	hash.Write(cartridge.prgMem)
+	if !cartridge.chrIsRam {
+		hash.Write(cartridge.chrMem)
 	}
+	copy(cartridge.hash[:], hash.Sum(nil))
 
-	return cartridge
+	// PRG RAM, including any battery backed RAM. The trainer needs the whole
+	// 8KB to be present.
+	prgRamSize := info.PrgRamSize + info.PrgNvramSize
+	if cartridge.trainer != nil && prgRamSize < 8*1024 {
+		prgRamSize = 8 * 1024
+	}
+	cartridge.prgRam = make([]byte, prgRamSize)
+
+	// Four-screen cartridges provide their own memory for the 2 nametables
+	// missing from the NES.
+	cartridge.mirroring = info.Mirroring
+	if cartridge.mirroring == mirrorFourScreen {
+		cartridge.fourScreenRam = make([]byte, 2*1024)
+	}
+
+	// PlayChoice INST-ROM (bit 2 of mapper2 flags) follows CHR memory.
+	// XXX: ignoring INST-ROM data for now
+
+	cartridge.mapper = newMapper(cartridge)
+
+	return cartridge, nil
 }
 
-// Communicate with main (CPU) bus.
-func (c *Cartridge) cpuRead(addr uint16) byte {
-	mappedAddr := c.mapper.cpuMapRead(addr)
+// powerOn sets the cartridge's state for when the NES is powered on with it
+// inserted. The mapper is replaced by a new one, with its registers in their
+// power on state, and memory without a battery is cleared: PRG RAM, CHR RAM
+// and the four-screen nametables.
+func (c *Cartridge) powerOn() {
+	c.mirroring = c.Info.Mirroring
+	c.mapper = mapperRegistry[c.Info.MapperId](c)
 
-	return c.prgMem[mappedAddr]
+	if !c.Info.Battery {
+		zeroBytes(c.prgRam)
+	}
+	if c.chrIsRam {
+		zeroBytes(c.chrMem)
+	}
+	zeroBytes(c.fourScreenRam)
+
+	// The trainer is loaded into PRG RAM at $7000.
+	if c.trainer != nil {
+		copy(c.prgRam[trainerAddr-prgRamMinAddr:], c.trainer)
+	}
+}
+
+// Communicate with main (CPU) bus. Returns false for addresses the cartridge
+// doesn't drive, which read as open bus, see Mapper.cpuRead.
+func (c *Cartridge) cpuRead(addr uint16) (byte, bool) {
+	return c.mapper.cpuRead(addr)
 }
 
 func (c *Cartridge) cpuWrite(addr uint16, data byte) {
-	mappedAddr := c.mapper.cpuMapWrite(addr)
-	c.prgMem[mappedAddr] = data
+	c.mapper.cpuWrite(addr, data)
+}
+
+// PRG RAM smaller than 8KB is mirrored across $6000-$7FFF. Without any PRG RAM
+// reads return 0 and writes are ignored.
+func (c *Cartridge) prgRamRead(addr uint16) byte {
+	if len(c.prgRam) == 0 {
+		return 0
+	}
+
+	return c.prgRam[int(addr-prgRamMinAddr)%len(c.prgRam)]
+}
+
+func (c *Cartridge) prgRamWrite(addr uint16, data byte) {
+	if len(c.prgRam) == 0 {
+		return
+	}
+
+	c.prgRam[int(addr-prgRamMinAddr)%len(c.prgRam)] = data
+	c.prgRamDirty = true
 }
 
 // Communicate with PPU bus.
 func (c *Cartridge) ppuRead(addr uint16) byte {
-	mappedAddr := c.mapper.ppuMapRead(addr)
-
-	return c.chrMem[mappedAddr]
+	return c.mapper.ppuRead(addr)
 }
 
+// CHR ROM is read-only, only CHR RAM can be written to.
 func (c *Cartridge) ppuWrite(addr uint16, data byte) {
-	mappedAddr := c.mapper.ppuMapWrite(addr)
-	c.chrMem[mappedAddr] = data
+	c.mapper.ppuWrite(addr, data)
+}
+
+// ppuAddress notifies the mapper of an address put on the PPU bus.
+func (c *Cartridge) ppuAddress(addr uint16) {
+	c.mapper.ppuAddress(addr)
+}
+
+// nametableRead reads from the nametables, if the mapper maps them. Returns
+// false to use the nametables selected by the mirroring mode.
+func (c *Cartridge) nametableRead(addr uint16, ciram *[2][1024]byte) (byte, bool) {
+	return c.mapper.nametableRead(addr, ciram)
+}
+
+func (c *Cartridge) nametableWrite(addr uint16, data byte, ciram *[2][1024]byte) bool {
+	return c.mapper.nametableWrite(addr, data, ciram)
+}
+
+// chrFetched notifies the mapper of a completed pattern table read.
+func (c *Cartridge) chrFetched(addr uint16) {
+	c.mapper.chrFetched(addr)
+}
+
+func (c *Cartridge) ppuScanline(scanline int, rendering bool) {
+	c.mapper.ppuScanline(scanline, rendering)
+}
+
+func (c *Cartridge) cpuClock() {
+	c.mapper.cpuClock()
+}
+
+// irq returns whether the cartridge is asserting the CPU's IRQ line.
+func (c *Cartridge) irq() bool {
+	return c.mapper.irq()
+}
+
+// Hash returns the SHA-1 hash of the cartridge's PRG and CHR ROM.
+func (c *Cartridge) Hash() [romHashSize]byte {
+	return c.hash
+}
+
+// savePathFor returns the path of the .sav file next to the given ROM file.
+func savePathFor(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav"
+}
+
+// LoadSave loads battery backed PRG RAM from r. Save data of a different size
+// than PRG RAM, such as a truncated file or one from another emulator, is
+// loaded as far as it goes.
+func (c *Cartridge) LoadSave(r io.Reader) error {
+	n, err := io.ReadFull(r, c.prgRam)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		log.Printf("Save data is %d bytes, shorter than the %d bytes of PRG RAM\n", n, len(c.prgRam))
+	} else if err != nil {
+		return fmt.Errorf("unable to read save data: %w", err)
+	} else if extra, _ := io.Copy(ioutil.Discard, r); extra > 0 {
+		log.Printf("Save data is %d bytes longer than PRG RAM, ignoring the rest\n", extra)
+	}
+
+	c.prgRamDirty = false
+
+	return nil
+}
+
+// WriteSave writes battery backed PRG RAM to w.
+func (c *Cartridge) WriteSave(w io.Writer) error {
+	_, err := w.Write(c.prgRam)
+
+	return err
+}
+
+// loadSaveFile loads battery backed PRG RAM from the cartridge's .sav file.
+// A missing file is not an error, as the game has not been saved yet.
+func (c *Cartridge) loadSaveFile() error {
+	f, err := os.Open(c.SavePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.LoadSave(f)
+}
+
+// Flush writes battery backed PRG RAM to the cartridge's .sav file, if it has
+// changed since it was last loaded or saved. The data is written to a
+// temporary file first, then moved over the .sav file, so that it is never
+// left part written.
+func (c *Cartridge) Flush() error {
+	if !c.Info.Battery || c.SavePath == "" || !c.prgRamDirty {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err := c.WriteSave(&buf)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(c.SavePath, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	c.prgRamDirty = false
+
+	return nil
 }
 
 type MirrorMode int
@@ -145,4 +386,56 @@ const (
 	mirrorVertical
 	mirrorOnescreenLo
 	mirrorOnescreenHi
+	mirrorFourScreen
 )
+
+func (m MirrorMode) String() string {
+	switch m {
+	case mirrorHorizontal:
+		return "horizontal"
+	case mirrorVertical:
+		return "vertical"
+	case mirrorOnescreenLo:
+		return "single-screen (low)"
+	case mirrorOnescreenHi:
+		return "single-screen (high)"
+	case mirrorFourScreen:
+		return "four-screen"
+	}
+
+	return fmt.Sprintf("MirrorMode(%d)", int(m))
+}
+
+// writeFileAtomic replaces the file at path with data, by writing a temporary
+// file in the same directory and renaming it.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Once renamed, removing the temporary file fails harmlessly.
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	// Temporary files are created only readable by their owner.
+	err = os.Chmod(f.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
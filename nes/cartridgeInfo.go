@@ -0,0 +1,227 @@
+package nes
+
+import "fmt"
+
+// CartridgeInfo describes a cartridge, as declared by its iNES or NES 2.0
+// header. Memory sizes are in bytes.
+//
+// reference: https://wiki.nesdev.com/w/index.php/NES_2.0
+type CartridgeInfo struct {
+	Format RomFormat // iNES or NES 2.0
+
+	MapperId  int // Mapper number, up to 12 bits for NES 2.0
+	Submapper int // NES 2.0 only
+
+	PrgRomSize   int
+	ChrRomSize   int
+	PrgRamSize   int // Volatile PRG RAM
+	PrgNvramSize int // Non-volatile (battery backed) PRG RAM
+	ChrRamSize   int // Volatile CHR RAM
+	ChrNvramSize int // Non-volatile (battery backed) CHR RAM
+
+	Mirroring MirrorMode // Nametable mirroring, may be changed by the mapper
+	Battery   bool       // Cartridge contains battery backed memory
+	Trainer   bool       // 512-byte trainer precedes PRG ROM
+
+	Timing              Timing      // CPU/PPU timing
+	ConsoleType         ConsoleType // Console the ROM was made for
+	VsPpuType           int         // Vs. System PPU type (NES 2.0 only)
+	VsHardwareType      int         // Vs. System hardware type (NES 2.0 only)
+	ExtendedConsoleType int         // Extended console type (NES 2.0 only)
+	MiscRoms            int         // Number of miscellaneous ROMs (NES 2.0 only)
+	ExpansionDevice     int         // Default expansion device (NES 2.0 only)
+}
+
+// RomFormat is the format of a cartridge's header.
+type RomFormat int
+
+const (
+	FormatINES RomFormat = iota
+	FormatNES20
+)
+
+// Timing is the CPU/PPU timing (region) a cartridge was made for.
+type Timing int
+
+const (
+	TimingNTSC  Timing = iota // RP2C02 ("NTSC NES")
+	TimingPAL                 // RP2C07 ("Licensed PAL NES")
+	TimingMulti               // Multiple-region
+	TimingDendy               // UMC 6527P ("Dendy")
+)
+
+// ConsoleType is the type of console a cartridge was made for.
+type ConsoleType int
+
+const (
+	ConsoleNES        ConsoleType = iota // Nintendo Entertainment System/Family Computer
+	ConsoleVsSystem                      // Nintendo Vs. System
+	ConsolePlayChoice                    // Nintendo Playchoice 10
+	ConsoleExtended                      // See ExtendedConsoleType
+)
+
+const (
+	prgRomChunkSize int = 16 * 1024
+	chrRomChunkSize int = 8 * 1024
+
+	// Largest ROM size supported, guards against absurd exponent sizes.
+	maxRomSize int = 64 * 1024 * 1024
+)
+
+// isNes20 returns whether the header is in the NES 2.0 format, identified by
+// bits 2-3 of flags 7 being 0b10.
+func (h *CartridgeHeader) isNes20() bool {
+	return h.Mapper2&0x0C == 0x08
+}
+
+// parseHeader decodes an iNES or NES 2.0 header into a CartridgeInfo.
+func parseHeader(h *CartridgeHeader) (CartridgeInfo, error) {
+	info := CartridgeInfo{
+		Mirroring: mirrorHorizontal,
+		Battery:   h.Mapper1&(1<<1) > 0,
+		Trainer:   h.Mapper1&(1<<2) > 0,
+	}
+
+	// Bit 3 of flags 6 takes priority over the mirroring in bit 0.
+	if h.Mapper1&(1<<3) > 0 {
+		info.Mirroring = mirrorFourScreen
+	} else if h.Mapper1&(1<<0) > 0 {
+		info.Mirroring = mirrorVertical
+	}
+
+	if h.isNes20() {
+		parseNes20Header(h, &info)
+	} else {
+		parseInesHeader(h, &info)
+	}
+
+	if info.PrgRomSize == 0 {
+		return info, fmt.Errorf("%w: no PRG ROM", ErrBadSize)
+	}
+	if info.PrgRomSize > maxRomSize || info.ChrRomSize > maxRomSize {
+		return info, fmt.Errorf("%w: PRG ROM %d bytes, CHR ROM %d bytes",
+			ErrBadSize, info.PrgRomSize, info.ChrRomSize)
+	}
+
+	return info, nil
+}
+
+// parseInesHeader decodes the fields of an iNES 1.0 header.
+// reference: https://wiki.nesdev.com/w/index.php/INES
+func parseInesHeader(h *CartridgeHeader, info *CartridgeInfo) {
+	info.Format = FormatINES
+
+	// Bytes 12-15 should be zero, otherwise bytes 7-15 are likely garbage
+	// (e.g. "DiskDude!") and are ignored, leaving only the low 4 bits of the
+	// mapper ID, the default 8KB of PRG RAM and NTSC timing.
+	mapper2, prgRamSize8k, tvSystem := h.Mapper2, h.PrgRamSize, h.TvSystem1
+	if h.Unused[1] != 0 || h.Unused[2] != 0 || h.Unused[3] != 0 || h.Unused[4] != 0 {
+		mapper2, prgRamSize8k, tvSystem = 0, 0, 0
+	}
+
+	// Mapper ID from high 4 bits of both mapper flags.
+	mapperLo := h.Mapper1 >> 4
+	mapperHi := mapper2 >> 4
+	info.MapperId = int(mapperHi)<<4 | int(mapperLo)
+
+	info.PrgRomSize = int(h.PrgRomChunks) * prgRomChunkSize
+	info.ChrRomSize = int(h.ChrRomChunks) * chrRomChunkSize
+
+	// No CHR ROM implies 8KB of CHR RAM.
+	if info.ChrRomSize == 0 {
+		info.ChrRamSize = 8 * 1024
+	}
+
+	// PRG RAM size in 8KB units, a value of 0 infers 8KB for compatibility.
+	prgRamSize := int(prgRamSize8k) * 8 * 1024
+	if prgRamSize == 0 {
+		prgRamSize = 8 * 1024
+	}
+	if info.Battery {
+		info.PrgNvramSize = prgRamSize
+	} else {
+		info.PrgRamSize = prgRamSize
+	}
+
+	if tvSystem&0x01 > 0 {
+		info.Timing = TimingPAL
+	}
+
+	if mapper2&0x01 > 0 {
+		info.ConsoleType = ConsoleVsSystem
+	} else if mapper2&0x02 > 0 {
+		info.ConsoleType = ConsolePlayChoice
+	}
+}
+
+// parseNes20Header decodes the fields of an NES 2.0 header. Bytes 8-15 of the
+// header are reinterpreted as follows:
+//
+//	8:  mapper MSB (bits 0-3), submapper (bits 4-7)
+//	9:  PRG ROM size MSB (bits 0-3), CHR ROM size MSB (bits 4-7)
+//	10: PRG RAM shift (bits 0-3), PRG NVRAM shift (bits 4-7)
+//	11: CHR RAM shift (bits 0-3), CHR NVRAM shift (bits 4-7)
+//	12: CPU/PPU timing (bits 0-1)
+//	13: Vs. System type, or extended console type
+//	14: miscellaneous ROM count (bits 0-1)
+//	15: default expansion device (bits 0-5)
+func parseNes20Header(h *CartridgeHeader, info *CartridgeInfo) {
+	info.Format = FormatNES20
+
+	mapperLo := int(h.Mapper1 >> 4)
+	mapperMid := int(h.Mapper2 >> 4)
+	mapperHi := int(h.PrgRamSize & 0x0F)
+	info.MapperId = mapperHi<<8 | mapperMid<<4 | mapperLo
+	info.Submapper = int(h.PrgRamSize >> 4)
+
+	info.PrgRomSize = nes20RomSize(h.PrgRomChunks, h.TvSystem1&0x0F, prgRomChunkSize)
+	info.ChrRomSize = nes20RomSize(h.ChrRomChunks, h.TvSystem1>>4, chrRomChunkSize)
+
+	info.PrgRamSize = nes20RamSize(h.TvSystem2 & 0x0F)
+	info.PrgNvramSize = nes20RamSize(h.TvSystem2 >> 4)
+	info.ChrRamSize = nes20RamSize(h.Unused[0] & 0x0F)
+	info.ChrNvramSize = nes20RamSize(h.Unused[0] >> 4)
+
+	info.Timing = Timing(h.Unused[1] & 0x03)
+
+	info.ConsoleType = ConsoleType(h.Mapper2 & 0x03)
+	switch info.ConsoleType {
+	case ConsoleVsSystem:
+		info.VsPpuType = int(h.Unused[2] & 0x0F)
+		info.VsHardwareType = int(h.Unused[2] >> 4)
+	case ConsoleExtended:
+		info.ExtendedConsoleType = int(h.Unused[2] & 0x0F)
+	}
+
+	info.MiscRoms = int(h.Unused[3] & 0x03)
+	info.ExpansionDevice = int(h.Unused[4] & 0x3F)
+}
+
+// nes20RomSize returns the size in bytes of a NES 2.0 ROM area, from the LSB
+// in the header's size byte and the 4-bit MSB. An MSB of 0xF selects the
+// exponent-multiplier notation, where size = 2^E * (MM*2 + 1) with the LSB
+// laid out as EEEEEEMM.
+func nes20RomSize(lsb, msb byte, chunkSize int) int {
+	if msb == 0x0F {
+		exponent := uint(lsb >> 2)
+		multiplier := int(lsb&0x03)*2 + 1
+		if exponent > 30 {
+			// Too large to be a real ROM, caught by size validation.
+			return maxRomSize + 1
+		}
+
+		return (1 << exponent) * multiplier
+	}
+
+	return (int(msb)<<8 | int(lsb)) * chunkSize
+}
+
+// nes20RamSize returns the size in bytes of a NES 2.0 RAM area from its shift
+// count, where size = 64 << shift, and a shift of 0 means no RAM.
+func nes20RamSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+
+	return 64 << shift
+}
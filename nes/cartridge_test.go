@@ -1,6 +1,13 @@
 package nes
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -8,5 +15,285 @@ import (
 const testRom = "../roms/DK.nes"
 
 func TestNewCartridge(t *testing.T) {
-	_ = NewCartridge(testRom)
+	if _, err := os.Stat(testRom); err != nil {
+		t.Skipf("test ROM not available: %v", err)
+	}
+
+	_, err := NewCartridge(testRom)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadCartridge(t *testing.T) {
+	rom := newTestRom(testProgram)
+
+	cart, err := LoadCartridge(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cart.prgMem) != 16*1024 {
+		t.Errorf("got PRG ROM size %d, want %d", len(cart.prgMem), 16*1024)
+	}
+	if len(cart.chrMem) != 8*1024 {
+		t.Errorf("got CHR ROM size %d, want %d", len(cart.chrMem), 8*1024)
+	}
+	if got, _ := cart.cpuRead(0x8000); got != testProgram[0] {
+		t.Errorf("got $8000 = %#02X, want %#02X", got, testProgram[0])
+	}
+}
+
+func TestLoadCartridgeErrors(t *testing.T) {
+	rom := newTestRom(testProgram)
+
+	// withHeader returns a copy of the test ROM, with header byte i set to b.
+	withHeader := func(i int, b byte) []byte {
+		r := append([]byte{}, rom...)
+		r[i] = b
+		return r
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrTruncatedHeader},
+		{"short header", rom[:10], ErrTruncatedHeader},
+		{"bad magic", withHeader(3, 0x00), ErrBadMagic},
+		{"no PRG ROM", withHeader(4, 0), ErrBadSize},
+		{"truncated trainer", withHeader(6, 0x04)[:16+100], ErrTruncatedTrainer},
+		{"truncated PRG ROM", rom[:16+1024], ErrTruncatedPrgRom},
+		{"truncated CHR ROM", rom[:len(rom)-1], ErrTruncatedChrRom},
+		{"unsupported mapper", withHeader(6, 0xF0), ErrUnsupportedMapper},
+	}
+
+	for _, test := range tests {
+		_, err := LoadCartridge(bytes.NewReader(test.data))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	var mapperErr *UnsupportedMapperError
+	_, err := LoadCartridge(bytes.NewReader(withHeader(6, 0xF0)))
+	if !errors.As(err, &mapperErr) || mapperErr.MapperId != 0x0F {
+		t.Errorf("got error %v, want unsupported mapper 15", err)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   CartridgeInfo
+	}{
+		{
+			"iNES",
+			[]byte{'N', 'E', 'S', 0x1A, 2, 1, 0x12, 0x40, 0, 1, 0, 0, 0, 0, 0, 0},
+			CartridgeInfo{
+				Format:       FormatINES,
+				MapperId:     0x41,
+				PrgRomSize:   32 * 1024,
+				ChrRomSize:   8 * 1024,
+				PrgNvramSize: 8 * 1024,
+				Battery:      true,
+				Timing:       TimingPAL,
+			},
+		},
+		{
+			"iNES with garbage in bytes 7-15",
+			[]byte{'N', 'E', 'S', 0x1A, 1, 1, 0x10, 'D', 'i', 's', 'k', 'D', 'u', 'd', 'e', '!'},
+			CartridgeInfo{
+				Format:     FormatINES,
+				MapperId:   0x01,
+				PrgRomSize: 16 * 1024,
+				ChrRomSize: 8 * 1024,
+				PrgRamSize: 8 * 1024,
+			},
+		},
+		{
+			"NES 2.0",
+			[]byte{'N', 'E', 'S', 0x1A, 0x00, 0x00, 0x42, 0x5B, 0x21, 0x12, 0x70, 0x07, 0x03, 0x05, 0x01, 0x2A},
+			CartridgeInfo{
+				Format:              FormatNES20,
+				MapperId:            0x154,
+				Submapper:           2,
+				PrgRomSize:          0x200 * 16 * 1024,
+				ChrRomSize:          0x100 * 8 * 1024,
+				PrgNvramSize:        64 << 7,
+				ChrRamSize:          64 << 7,
+				Battery:             true,
+				Timing:              TimingDendy,
+				ConsoleType:         ConsoleExtended,
+				ExtendedConsoleType: 5,
+				MiscRoms:            1,
+				ExpansionDevice:     0x2A,
+			},
+		},
+		{
+			"NES 2.0 exponent-multiplier sizes",
+			[]byte{'N', 'E', 'S', 0x1A, 0x3D, 0x00, 0x00, 0x08, 0x00, 0x0F, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			CartridgeInfo{
+				Format:     FormatNES20,
+				PrgRomSize: (1 << 15) * 3,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		header := new(CartridgeHeader)
+		if err := binary.Read(bytes.NewReader(test.header), binary.BigEndian, header); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := parseHeader(header)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBatterySave(t *testing.T) {
+	rom := newTestRom(testProgram)
+	rom[6] |= 0x02 // battery
+	romPath := writeTestRom(t, rom)
+	savePath := strings.TrimSuffix(romPath, ".nes") + ".sav"
+
+	cart, err := NewCartridge(romPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cart.SavePath != savePath {
+		t.Fatalf("got save path %v, want %v", cart.SavePath, savePath)
+	}
+
+	// Nothing to save yet.
+	if err := cart.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(savePath); !os.IsNotExist(err) {
+		t.Fatalf("save file written before PRG RAM was modified: %v", err)
+	}
+
+	cart.cpuWrite(0x6000, 0x12)
+	cart.cpuWrite(0x7FFF, 0x34)
+	if err := cart.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(romPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files next to the ROM after saving, want the .sav only", len(files)-1)
+	}
+
+	// Reload the cartridge, and its save.
+	cart, err = NewCartridge(romPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cart.cpuRead(0x6000); got != 0x12 {
+		t.Errorf("got $6000 = %#02X, want %#02X", got, 0x12)
+	}
+	if got, _ := cart.cpuRead(0x7FFF); got != 0x34 {
+		t.Errorf("got $7FFF = %#02X, want %#02X", got, 0x34)
+	}
+}
+
+func TestBatterySaveShort(t *testing.T) {
+	rom := newTestRom(testProgram)
+	rom[6] |= 0x02 // battery
+	romPath := writeTestRom(t, rom)
+	savePath := strings.TrimSuffix(romPath, ".nes") + ".sav"
+
+	// Truncated save, the rest of PRG RAM is left empty.
+	if err := ioutil.WriteFile(savePath, []byte{0x12, 0x34}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := NewCartridge(romPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[uint16]byte{0x6000: 0x12, 0x6001: 0x34, 0x6002: 0} {
+		if got, _ := cart.cpuRead(addr); got != want {
+			t.Errorf("got $%04X = %#02X, want %#02X", addr, got, want)
+		}
+	}
+}
+
+func TestTrainer(t *testing.T) {
+	header := []byte{'N', 'E', 'S', 0x1A, 1, 1, 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	trainer := make([]byte, 512)
+	for i := range trainer {
+		trainer[i] = byte(i)
+	}
+
+	rom := append(header, trainer...)
+	rom = append(rom, newTestRom(testProgram)[16:]...)
+
+	console := NewConsole()
+	cart, err := LoadCartridge(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.InsertCartridge(cart)
+
+	bus := console.Bus()
+	for _, addr := range []uint16{0x7000, 0x7001, 0x70FF, 0x7100, 0x71FF} {
+		want := trainer[addr-0x7000]
+		if got := bus.CpuRead(addr); got != want {
+			t.Errorf("got $%04X = %#02X, want %#02X", addr, got, want)
+		}
+	}
+
+	// PRG ROM follows the trainer.
+	if got := bus.CpuRead(0x8000); got != testProgram[0] {
+		t.Errorf("got $8000 = %#02X, want %#02X", got, testProgram[0])
+	}
+}
+
+func TestChrMemory(t *testing.T) {
+	tests := []struct {
+		name      string
+		chrChunks byte
+		writable  bool
+	}{
+		{"CHR ROM", 1, false},
+		{"CHR RAM", 0, true},
+	}
+
+	for _, test := range tests {
+		rom := newTestRom(testProgram)
+		rom[5] = test.chrChunks
+		rom = rom[:16+16*1024+int(test.chrChunks)*8*1024]
+
+		cart, err := LoadCartridge(bytes.NewReader(rom))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(cart.chrMem) != 8*1024 {
+			t.Errorf("%s: got CHR size %d, want %d", test.name, len(cart.chrMem), 8*1024)
+		}
+
+		ppu := NewPpu()
+		ppu.ConnectCartridge(cart)
+		for _, addr := range []uint16{0x0000, 0x1FFF} {
+			ppu.ppuWrite(addr, 0x5A)
+
+			want := byte(0x00)
+			if test.writable {
+				want = 0x5A
+			}
+			if got := ppu.ppuRead(addr); got != want {
+				t.Errorf("%s: got $%04X = %#02X, want %#02X", test.name, addr, got, want)
+			}
+		}
+	}
 }
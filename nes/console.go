@@ -0,0 +1,164 @@
+package nes
+
+import (
+	"image"
+	"io"
+)
+
+// Console is an NES that is driven programmatically rather than through a
+// window. Frames are rendered to an in-memory FrameBuffer.
+type Console struct {
+	bus   *Bus
+	frame *FrameBuffer
+}
+
+// NewConsole returns a powered on NES with no cartridge inserted.
+func NewConsole() *Console {
+	c := &Console{
+		frame: NewFrameBuffer(),
+	}
+	c.powerOn(nil)
+
+	return c
+}
+
+// powerOn replaces the NES hardware with a freshly powered on bus, inserting
+// the given cartridge if there is one. Audio output and recording carry on.
+func (c *Console) powerOn(cart *Cartridge) {
+	old := c.bus
+
+	c.bus = NewBus(false, false)
+	c.bus.Ppu.ConnectFrameSink(c.frame)
+	if old != nil {
+		c.bus.audio = old.audio
+		c.bus.recorder = old.recorder
+		c.bus.connectAudio()
+	}
+
+	if cart != nil {
+		c.bus.InsertCartridge(cart)
+		c.bus.Reset()
+	}
+}
+
+// Bus returns the NES main bus, giving access to the CPU, PPU and memory.
+func (c *Console) Bus() *Bus {
+	return c.bus
+}
+
+// LoadROM inserts the cartridge at the given path, and resets the NES.
+func (c *Console) LoadROM(filepath string) error {
+	cart, err := NewCartridge(filepath)
+	if err != nil {
+		return err
+	}
+
+	c.InsertCartridge(cart)
+
+	return nil
+}
+
+// InsertCartridge inserts the given cartridge, such as one created with
+// LoadCartridge, and resets the NES. The previous cartridge's battery backed
+// RAM is saved first.
+func (c *Console) InsertCartridge(cart *Cartridge) {
+	c.bus.flushCartridge()
+
+	c.bus.InsertCartridge(cart)
+	c.bus.Reset()
+}
+
+// Close saves the cartridge's battery backed RAM to its .sav file, and
+// finishes any WAV recording. It should be called once finished with the
+// console.
+func (c *Console) Close() error {
+	return c.bus.Close()
+}
+
+// Reset presses the NES reset button.
+func (c *Console) Reset() {
+	c.bus.Reset()
+}
+
+// PowerCycle turns the NES off and back on, clearing all memory but the
+// cartridge's battery backed RAM.
+func (c *Console) PowerCycle() {
+	c.powerOn(c.bus.Cart)
+}
+
+// StepInstruction runs the NES until the CPU has executed one instruction. If
+// the CPU is part way through an instruction, that instruction is finished.
+func (c *Console) StepInstruction() {
+	if c.bus.Cart == nil {
+		return
+	}
+
+	for {
+		c.bus.Clock()
+
+		// Stop once the CPU is about to fetch its next instruction.
+		if c.bus.ClockCount%3 == 0 && c.bus.Cpu.Cycles == 0 && !c.bus.dmaTransfer &&
+			c.bus.dmcStall == 0 {
+			break
+		}
+	}
+}
+
+// RunFrame runs the NES until the PPU has rendered one whole frame.
+func (c *Console) RunFrame() {
+	if c.bus.Cart == nil {
+		return
+	}
+
+	c.bus.RunFrame()
+}
+
+// SetButtons sets the state of the controller in the given port (0 or 1).
+// Each bit of the mask represents a button, see ButtonA, ButtonB, etc.
+func (c *Console) SetButtons(port int, mask byte) {
+	if port < 0 || port >= len(c.bus.Controller) {
+		return
+	}
+
+	c.bus.Controller[port].SetState(mask)
+}
+
+// SaveState writes the state of the whole NES to w.
+func (c *Console) SaveState(w io.Writer) error {
+	return c.bus.SaveState(w)
+}
+
+// LoadState restores the state of the NES from a save state written by
+// SaveState, with the same cartridge inserted.
+func (c *Console) LoadState(r io.Reader) error {
+	return c.bus.LoadState(r)
+}
+
+// Rewind steps the NES back to its most recent rewind snapshot, taken every
+// few frames by RunFrame, and renders the frame following it. Returns false
+// if there is nothing left to rewind to.
+func (c *Console) Rewind() bool {
+	return c.bus.RewindFrame()
+}
+
+// ConnectAudioSink sets the sink that audio is written to, such as an
+// AudioBuffer. Audio is only mixed once a sink is connected.
+func (c *Console) ConnectAudioSink(s AudioSink) {
+	c.bus.ConnectAudioSink(s)
+}
+
+// RecordWav starts recording audio to a 16-bit PCM WAV file at the given
+// path, until StopRecording or Close is called.
+func (c *Console) RecordWav(path string) error {
+	return c.bus.RecordWav(path)
+}
+
+// StopRecording finishes the WAV recording started by RecordWav.
+func (c *Console) StopRecording() error {
+	return c.bus.StopRecording()
+}
+
+// Framebuffer returns the most recently rendered frame.
+func (c *Console) Framebuffer() *image.RGBA {
+	return c.frame.RGBA()
+}
@@ -0,0 +1,129 @@
+package nes
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Test program, placed at $8000:
+//
+//	LDA #$05
+//	STA $10
+//	JMP $8004
+var testProgram = []byte{0xA9, 0x05, 0x85, 0x10, 0x4C, 0x04, 0x80}
+
+// newTestRom returns an iNES (NROM) file with 16KB PRG ROM containing the
+// given program at $8000, and 8KB of empty CHR ROM.
+func newTestRom(program []byte) []byte {
+	header := []byte{'N', 'E', 'S', 0x1A, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	prg := make([]byte, 16*1024)
+	copy(prg, program)
+
+	// Reset vector -> $8000
+	prg[0x3FFC] = 0x00
+	prg[0x3FFD] = 0x80
+
+	rom := append(header, prg...)
+	rom = append(rom, make([]byte, 8*1024)...)
+
+	return rom
+}
+
+// writeTestRom writes the given ROM to a temporary file, returning its path.
+func writeTestRom(t *testing.T, rom []byte) string {
+	path := filepath.Join(t.TempDir(), "test.nes")
+	if err := ioutil.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// newTestConsole returns a console running a test ROM with the given program.
+func newTestConsole(t *testing.T, program []byte) *Console {
+	console := NewConsole()
+	if err := console.LoadROM(writeTestRom(t, newTestRom(program))); err != nil {
+		t.Fatal(err)
+	}
+
+	return console
+}
+
+func TestConsoleStepInstruction(t *testing.T) {
+	console := newTestConsole(t, testProgram)
+	cpu := console.Bus().Cpu
+
+	// Finish the reset sequence.
+	console.StepInstruction()
+	if cpu.Pc != 0x8000 {
+		t.Fatalf("got PC %#04X after reset, want %#04X", cpu.Pc, 0x8000)
+	}
+
+	console.StepInstruction() // LDA #$05
+	if cpu.A != 0x05 {
+		t.Errorf("got A %#02X, want %#02X", cpu.A, 0x05)
+	}
+
+	console.StepInstruction() // STA $10
+	if got := console.Bus().Ram[0x10]; got != 0x05 {
+		t.Errorf("got $0010 = %#02X, want %#02X", got, 0x05)
+	}
+	if cpu.Pc != 0x8004 {
+		t.Errorf("got PC %#04X, want %#04X", cpu.Pc, 0x8004)
+	}
+}
+
+func TestConsoleRunFrame(t *testing.T) {
+	console := newTestConsole(t, testProgram)
+
+	for i := 1; i <= 3; i++ {
+		console.RunFrame()
+		if console.frame.Frames != i {
+			t.Errorf("got %d frames, want %d", console.frame.Frames, i)
+		}
+	}
+
+	// Rendering is disabled, so the whole frame is the backdrop color.
+	img := console.Framebuffer()
+	want := ntscPalette[0]
+	for _, pt := range [][2]int{{0, 0}, {128, 120}, {255, 239}} {
+		if got := img.RGBAAt(pt[0], pt[1]); got != want {
+			t.Errorf("got pixel %v = %v, want %v", pt, got, want)
+		}
+	}
+}
+
+func TestConsoleSetButtons(t *testing.T) {
+	console := newTestConsole(t, testProgram)
+	bus := console.Bus()
+
+	console.SetButtons(0, ButtonA|ButtonStart)
+
+	// Strobe the controllers, then read back each button (A first).
+	bus.CpuWrite(0x4016, 1)
+	want := []byte{1, 0, 0, 1, 0, 0, 0, 0}
+	for i, w := range want {
+		if got := bus.CpuRead(0x4016); got != w {
+			t.Errorf("button %d: got %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestConsolePowerCycle(t *testing.T) {
+	console := newTestConsole(t, testProgram)
+
+	console.Bus().CpuWrite(0x0010, 0x12)
+	console.Bus().CpuWrite(0x6000, 0x34)
+	console.PowerCycle()
+
+	// The cartridge has no battery, so its PRG RAM is cleared too.
+	bus := console.Bus()
+	if got := bus.CpuRead(0x0010); got != 0 {
+		t.Errorf("got $0010 = %#02X after power cycle, want 0", got)
+	}
+	if got := bus.CpuRead(0x6000); got != 0 {
+		t.Errorf("got $6000 = %#02X after power cycle, want 0", got)
+	}
+}
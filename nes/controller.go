@@ -1,53 +1,29 @@
 package nes
 
-import (
-	"github.com/faiface/pixel/pixelgl"
-)
-
 type Controller struct {
 	buttonState []bool // Key press state: on/off
 }
 
 func NewController() *Controller {
 	return &Controller{
-		buttonState: make([]bool, len(controllerKeys)),
+		buttonState: make([]bool, numButtons),
 	}
 }
 
-// Available NES controller buttons and their keyboard binds
-// Keyboard binds:
-/*
-	0: Right  ---> D
-	1: Left   ---> A
-	2: Down   ---> S
-	3: Up     ---> W
-	4: Start  ---> Enter
-	5: Select ---> Right Shift
-	6: B      ---> K
-	7: A      ---> J
-*/
+// Button masks, as used by Console.SetButtons. Each button's bit position is
+// the order the NES reads the buttons in, from last to first.
 const (
-	keyRight int = iota
-	keyLeft
-	keyDown
-	keyUp
-	keyStart
-	keySelect
-	keyB
-	keyA
+	ButtonRight byte = 1 << iota
+	ButtonLeft
+	ButtonDown
+	ButtonUp
+	ButtonStart
+	ButtonSelect
+	ButtonB
+	ButtonA
 )
 
-// TODO: add 2nd controller keys
-var controllerKeys = map[int]pixelgl.Button{
-	keyRight:  pixelgl.KeyD,
-	keyLeft:   pixelgl.KeyA,
-	keyDown:   pixelgl.KeyS,
-	keyUp:     pixelgl.KeyW,
-	keyStart:  pixelgl.KeyEnter,
-	keySelect: pixelgl.KeyRightShift,
-	keyB:      pixelgl.KeyK,
-	keyA:      pixelgl.KeyJ,
-}
+const numButtons int = 8
 
 // GetState returns a byte, with each bit representing the state of a button on
 // the controller.
@@ -63,17 +39,10 @@ func (c *Controller) GetState() byte {
 	return state
 }
 
-func (c *Controller) updateControllerInput(win *pixelgl.Window) {
-	// Key down
-	for idx, key := range controllerKeys {
-		if win.JustPressed(key) {
-			c.buttonState[idx] = true
-		}
-	}
-	// Key up
-	for idx, key := range controllerKeys {
-		if win.JustReleased(key) {
-			c.buttonState[idx] = false
-		}
+// SetState sets the state of every button on the controller, with each bit
+// of the given byte representing the state of a button.
+func (c *Controller) SetState(state byte) {
+	for pos := range c.buttonState {
+		c.buttonState[pos] = state&(1<<pos) > 0
 	}
 }
@@ -146,6 +146,14 @@ func (cpu *Cpu6502) write(addr uint16, data byte) {
 	cpu.bus.CpuWrite(addr, data)
 }
 
+// Write the result of a read-modify-write instruction. The 6502 writes the
+// unmodified value back the cycle before writing the result, which some
+// mappers (e.g. MMC1) respond to.
+func (cpu *Cpu6502) modifyWrite(addr uint16, old, result byte) {
+	cpu.write(addr, old)
+	cpu.write(addr, result)
+}
+
 // Read a word from memory (little endian order).
 func (cpu *Cpu6502) readWord(addr uint16) uint16 {
 	lo := cpu.read(addr)
@@ -232,22 +240,26 @@ func (cpu *Cpu6502) Reset() {
 	cpu.Cycles = 7
 }
 
-// Interrupt Request
+// Interrupt Request. Ignored while the interrupt disable flag is set.
 func (cpu *Cpu6502) IRQ() {
+	if cpu.getFlag(StatusFlagI) > 0 {
+		return
+	}
+
 	// Push program counter to the stack
 	pcHi := byte((cpu.Pc >> 8) & 0x00FF)
 	pcLo := byte(cpu.Pc & 0x00FF)
 	cpu.stackPush(pcHi)
 	cpu.stackPush(pcLo)
 
-	// Set flags: interrupt, break, and unused
-	cpu.setFlag(StatusFlagI, true)
-	cpu.setFlag(StatusFlagB, true)
+	// Push status flag to stack, the break flag is only pushed set by BRK.
+	cpu.setFlag(StatusFlagB, false)
 	cpu.setFlag(StatusFlagX, true)
-
-	// Push status flag to stack
 	cpu.stackPush(cpu.Status)
 
+	// Set flags: interrupt
+	cpu.setFlag(StatusFlagI, true)
+
 	// Set program counter to value stored at IRQ vector address
 	cpu.Pc = cpu.readWord(irqVectAddr)
 
@@ -570,7 +582,7 @@ func (cpu *Cpu6502) opASL() byte {
 	if cpu.isImpliedAddr {
 		cpu.A = result
 	} else {
-		cpu.write(cpu.AddrAbs, result)
+		cpu.modifyWrite(cpu.AddrAbs, cpu.Fetched, result)
 	}
 
 	cpu.setFlag(StatusFlagZ, cpu.A == 0)
@@ -838,7 +850,7 @@ func (cpu *Cpu6502) opDEC() byte {
 
 	cpu.Fetched--
 
-	cpu.write(cpu.AddrAbs, cpu.Fetched)
+	cpu.modifyWrite(cpu.AddrAbs, cpu.Fetched+1, cpu.Fetched)
 
 	cpu.setFlag(StatusFlagZ, cpu.Fetched == 0)         // if A == 0
 	cpu.setFlag(StatusFlagN, (cpu.Fetched&(1<<7) > 0)) // if bit 7 set
@@ -890,7 +902,7 @@ func (cpu *Cpu6502) opINC() byte {
 
 	cpu.Fetched++
 
-	cpu.write(cpu.AddrAbs, cpu.Fetched)
+	cpu.modifyWrite(cpu.AddrAbs, cpu.Fetched-1, cpu.Fetched)
 
 	cpu.setFlag(StatusFlagZ, cpu.Fetched == 0)         // if A == 0
 	cpu.setFlag(StatusFlagN, (cpu.Fetched&(1<<7) > 0)) // if bit 7 set
@@ -982,6 +994,7 @@ func (cpu *Cpu6502) opLDY() byte {
 // LSR - Logical Shift Right
 func (cpu *Cpu6502) opLSR() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	// Set carry flag to old bit 0.
 	cpu.setFlag(StatusFlagC, cpu.Fetched&0x1 > 0)
@@ -994,7 +1007,7 @@ func (cpu *Cpu6502) opLSR() byte {
 	if cpu.isImpliedAddr {
 		cpu.A = cpu.Fetched
 	} else {
-		cpu.write(cpu.AddrAbs, cpu.Fetched)
+		cpu.modifyWrite(cpu.AddrAbs, old, cpu.Fetched)
 	}
 
 	return 0x00
@@ -1056,6 +1069,7 @@ func (cpu *Cpu6502) opPLP() byte {
 // ROL - Rotate Left
 func (cpu *Cpu6502) opROL() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	carry := cpu.getFlag(StatusFlagC)
 
@@ -1073,7 +1087,7 @@ func (cpu *Cpu6502) opROL() byte {
 	if cpu.isImpliedAddr {
 		cpu.A = cpu.Fetched
 	} else {
-		cpu.write(cpu.AddrAbs, cpu.Fetched)
+		cpu.modifyWrite(cpu.AddrAbs, old, cpu.Fetched)
 	}
 
 	return 0x00
@@ -1082,6 +1096,7 @@ func (cpu *Cpu6502) opROL() byte {
 // ROR - Rotate Right
 func (cpu *Cpu6502) opROR() byte {
 	cpu.fetch()
+	old := cpu.Fetched
 
 	carry := cpu.getFlag(StatusFlagC)
 
@@ -1099,7 +1114,7 @@ func (cpu *Cpu6502) opROR() byte {
 	if cpu.isImpliedAddr {
 		cpu.A = cpu.Fetched
 	} else {
-		cpu.write(cpu.AddrAbs, cpu.Fetched)
+		cpu.modifyWrite(cpu.AddrAbs, old, cpu.Fetched)
 	}
 
 	return 0x00
@@ -23,7 +23,7 @@ func TestAmIZY(t *testing.T) {}
 ////////////////////////////////////////////////////////////////
 // Instructions
 func TestOpAND(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -59,7 +59,7 @@ func TestOpAND(t *testing.T) {
 }
 
 func TestOpASL(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -100,7 +100,7 @@ func TestOpASL(t *testing.T) {
 }
 
 func TestOpBPL(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -131,7 +131,7 @@ func TestOpBPL(t *testing.T) {
 }
 
 func TestOpBRK(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -166,7 +166,7 @@ func TestOpBRK(t *testing.T) {
 }
 
 func TestOpCLC(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -197,7 +197,7 @@ func TestOpCLC(t *testing.T) {
 }
 
 func TestOpJSR(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -228,7 +228,7 @@ func TestOpJSR(t *testing.T) {
 }
 
 func TestOpORA(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -262,7 +262,7 @@ func TestOpORA(t *testing.T) {
 }
 
 func TestOpPHP(t *testing.T) {
-	nes := NewBus()
+	nes := NewBus(false, false)
 	cpu := nes.Cpu
 
 	// Snapshot
@@ -283,7 +283,7 @@ func TestOpPHP(t *testing.T) {
 		{cpu.getFlag(StatusFlagV), flags & byte(StatusFlagV)}, // unchanged
 		{cpu.getFlag(StatusFlagN), flags & byte(StatusFlagN)}, // unchanged
 
-		{cpu.stackPop(), cpu.Status}, // check flags were pushed to stack
+		{cpu.stackPop(), cpu.Status | byte(StatusFlagB)}, // check flags were pushed to stack, with B set
 	}
 
 	// Test
@@ -0,0 +1,51 @@
+package display
+
+import (
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/n-ulricksen/nes-emulator/nes"
+)
+
+// NES controller buttons and their keyboard binds
+// Keyboard binds:
+/*
+	Right  ---> D
+	Left   ---> A
+	Down   ---> S
+	Up     ---> W
+	Start  ---> Enter
+	Select ---> Right Shift
+	B      ---> K
+	A      ---> J
+*/
+// TODO: add 2nd controller keys
+var controllerKeys = map[byte]pixelgl.Button{
+	nes.ButtonRight:  pixelgl.KeyD,
+	nes.ButtonLeft:   pixelgl.KeyA,
+	nes.ButtonDown:   pixelgl.KeyS,
+	nes.ButtonUp:     pixelgl.KeyW,
+	nes.ButtonStart:  pixelgl.KeyEnter,
+	nes.ButtonSelect: pixelgl.KeyRightShift,
+	nes.ButtonB:      pixelgl.KeyK,
+	nes.ButtonA:      pixelgl.KeyJ,
+}
+
+// updateControllerInput presses and releases the controller's buttons as
+// their keys are pressed and released.
+func updateControllerInput(c *nes.Controller, win *pixelgl.Window) {
+	state := c.GetState()
+
+	// Key down
+	for button, key := range controllerKeys {
+		if win.JustPressed(key) {
+			state |= button
+		}
+	}
+	// Key up
+	for button, key := range controllerKeys {
+		if win.JustReleased(key) {
+			state &^= button
+		}
+	}
+
+	c.SetState(state)
+}
@@ -1,4 +1,7 @@
-package nes
+// Package display runs the NES in a window, drawing frames with PixelGL and
+// reading the keyboard for the controllers and hotkeys. It is kept out of
+// package nes, as it needs cgo and OpenGL.
+package display
 
 import (
 	"image"
@@ -12,6 +15,7 @@ import (
 	"golang.org/x/image/font/basicfont"
 )
 
+// Display is a PixelGL window that the PPU renders to, see nes.FrameSink.
 type Display struct {
 	gameRgba  *image.RGBA // Rectangle of RGBA points, used to manipulate pixels on the screen.
 	debugRgba *image.RGBA
@@ -101,6 +105,17 @@ func (d *Display) DrawPixel(x, y int, c color.RGBA) {
 	d.gameRgba.SetRGBA(x, y, c)
 }
 
+// SetPixel implements FrameSink by drawing the pixel to the game display.
+func (d *Display) SetPixel(x, y int, idx byte, c color.RGBA) {
+	d.DrawPixel(x, y, c)
+}
+
+// EndFrame implements FrameSink by updating the screen with the completed
+// frame.
+func (d *Display) EndFrame() {
+	d.UpdateScreen()
+}
+
 func (d *Display) DrawDebugPixel(x, y int, c color.RGBA) {
 	d.debugRgba.SetRGBA(x, y, c)
 }
@@ -0,0 +1,110 @@
+package display
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/n-ulricksen/nes-emulator/nes"
+)
+
+// Emulator keyboard binds, separate from the controller binds:
+/*
+	0-9: Select save state slot
+	F5:  Save state to the selected slot
+	F7:  Load state from the selected slot
+	Backspace (hold): Rewind
+
+	Keypad 1-6:        Mute pulse 1, pulse 2, triangle, noise, DMC, expansion audio
+	Left Ctrl + 1-6:   Solo (keypad)
+	Keypad + / -:      Raise/lower the volume of the last channel muted or soloed
+*/
+var stateSlotKeys = [10]pixelgl.Button{
+	pixelgl.Key0, pixelgl.Key1, pixelgl.Key2, pixelgl.Key3, pixelgl.Key4,
+	pixelgl.Key5, pixelgl.Key6, pixelgl.Key7, pixelgl.Key8, pixelgl.Key9,
+}
+
+const (
+	saveStateKey = pixelgl.KeyF5
+	loadStateKey = pixelgl.KeyF7
+	rewindKey    = pixelgl.KeyBackspace
+
+	soloModifierKey = pixelgl.KeyLeftControl
+	volumeUpKey     = pixelgl.KeyKPAdd
+	volumeDownKey   = pixelgl.KeyKPSubtract
+
+	volumeStep float32 = 0.1
+)
+
+// Keypad keys for each audio channel, in nes.AudioChannel order.
+var audioChannelKeys = [nes.NumAudioChannels]pixelgl.Button{
+	pixelgl.KeyKP1, pixelgl.KeyKP2, pixelgl.KeyKP3,
+	pixelgl.KeyKP4, pixelgl.KeyKP5, pixelgl.KeyKP6,
+}
+
+// hotkeys holds the settings chosen with the emulator's keyboard binds.
+type hotkeys struct {
+	stateSlot    int              // Save state slot selected with the number keys
+	audioChannel nes.AudioChannel // Audio channel adjusted by the volume keys
+}
+
+// update handles the emulator's keyboard binds, run once per frame.
+func (h *hotkeys) update(win *pixelgl.Window, bus *nes.Bus) {
+	for slot, key := range stateSlotKeys {
+		if win.JustPressed(key) {
+			h.stateSlot = slot
+			fmt.Println("Save state slot:", slot)
+		}
+	}
+
+	if win.JustPressed(saveStateKey) {
+		err := bus.SaveStateFile(h.stateSlot)
+		if err != nil {
+			log.Printf("Unable to save state to slot %d\n%v\n", h.stateSlot, err)
+		} else {
+			fmt.Println("Saved state to slot", h.stateSlot)
+		}
+	}
+
+	if win.JustPressed(loadStateKey) {
+		err := bus.LoadStateFile(h.stateSlot)
+		if err != nil {
+			log.Printf("Unable to load state from slot %d\n%v\n", h.stateSlot, err)
+		} else {
+			fmt.Println("Loaded state from slot", h.stateSlot)
+		}
+	}
+
+	h.updateAudio(win, bus.Apu)
+}
+
+// updateAudio handles the per-channel audio controls.
+func (h *hotkeys) updateAudio(win *pixelgl.Window, apu *nes.Apu) {
+	for i, key := range audioChannelKeys {
+		if !win.JustPressed(key) {
+			continue
+		}
+
+		ch := nes.AudioChannel(i)
+		h.audioChannel = ch
+		if win.Pressed(soloModifierKey) {
+			apu.SetChannelSolo(ch, !apu.ChannelSolo(ch))
+			fmt.Printf("Solo %v: %v\n", ch, apu.ChannelSolo(ch))
+		} else {
+			apu.SetChannelMuted(ch, !apu.ChannelMuted(ch))
+			fmt.Printf("Mute %v: %v\n", ch, apu.ChannelMuted(ch))
+		}
+	}
+
+	step := float32(0)
+	if win.JustPressed(volumeUpKey) {
+		step = volumeStep
+	} else if win.JustPressed(volumeDownKey) {
+		step = -volumeStep
+	}
+	if step != 0 {
+		ch := h.audioChannel
+		apu.SetChannelVolume(ch, apu.ChannelVolume(ch)+step)
+		fmt.Printf("Volume %v: %.0f%%\n", ch, 100*apu.ChannelVolume(ch))
+	}
+}
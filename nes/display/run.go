@@ -0,0 +1,81 @@
+package display
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/n-ulricksen/nes-emulator/nes"
+)
+
+// Frames per second
+const fps float64 = 60
+
+// Run the NES in a new window until it is closed. Must be called from within
+// pixelgl.Run.
+func Run(bus *nes.Bus) {
+	// Create a PixelGL display for the PPU to render to.
+	display := NewDisplay(bus.IsDebug())
+
+	// PPU renders to the display.
+	bus.Ppu.ConnectFrameSink(display)
+
+	// The debug panel shows audio levels, with or without a sound card.
+	bus.Apu.SetLevelMetering(bus.IsDebug())
+
+	intervalInMilli := (1 / fps) * 1000
+	interval := time.Duration(intervalInMilli) * time.Millisecond
+	fmt.Println("Frame refresh time:", interval)
+
+	var keys hotkeys
+
+	// Use a timer to keep frames rendered steadily at a set FPS.
+	var t time.Time
+	for !display.window.Closed() {
+		// Run 1 whole frame, or step back while the rewind key is held.
+		t = time.Now()
+		if display.window.Pressed(rewindKey) {
+			bus.RewindFrame()
+		} else {
+			bus.RunFrame()
+		}
+
+		for i := range bus.Controller {
+			updateControllerInput(bus.Controller[i], display.window)
+		}
+		keys.update(display.window, bus)
+
+		if bus.IsDebug() {
+			display.drawDebugPanel(bus)
+		}
+
+		since := time.Since(t)
+		toSleep := interval - since
+		time.Sleep(toSleep)
+	}
+
+	err := bus.Close()
+	if err != nil {
+		log.Printf("Unable to save the cartridge or finish WAV recording\n%v\n", err)
+	}
+}
+
+// TODO: rewrite this.
+func (d *Display) drawDebugPanel(bus *nes.Bus) {
+	// Pattern tables
+	patternTable0 := bus.Ppu.GetPatternTable(0)
+	patternTable1 := bus.Ppu.GetPatternTable(1)
+
+	d.DrawDebugRGBA(8, int(gameH)-128-8, patternTable0)
+	d.DrawDebugRGBA(128+16, int(gameH)-128-8, patternTable1)
+
+	d.WriteRegDebugString(bus.CpuDebugString())
+
+	// Keyboard input
+	contDebugStr := fmt.Sprintf("Controller status:\n%08b\n\n%08b", bus.ControllerState[0], bus.ControllerState[1])
+	contDebugStr += "\n\n" + bus.AudioDebugString()
+	d.WriteControllerDebugString(contDebugStr)
+
+	// Disassembly
+	d.WriteInstDebugString(bus.DisassemblyLines())
+}
@@ -0,0 +1,72 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+)
+
+// Resolution of the frames rendered by the PPU.
+const (
+	nesResW float64 = 256
+	nesResH float64 = 240
+)
+
+// FrameSink receives the pixels rendered by the PPU. The display package's
+// window is one implementation, FrameBuffer is an in-memory one that needs no
+// window.
+type FrameSink interface {
+	// SetPixel sets the pixel at (x, y) to the color found at index idx of
+	// the NES system palette.
+	SetPixel(x, y int, idx byte, c color.RGBA)
+
+	// EndFrame is called once the PPU has finished rendering a frame.
+	EndFrame()
+}
+
+// FrameBuffer is a headless FrameSink, storing each frame both as RGBA and
+// as indices into the NES system palette.
+type FrameBuffer struct {
+	rgba    *image.RGBA     // Rendered frame in RGBA.
+	indexed *image.Paletted // Rendered frame as system palette indices.
+
+	Frames int // Total number of completed frames
+}
+
+func NewFrameBuffer() *FrameBuffer {
+	rect := image.Rect(0, 0, int(nesResW), int(nesResH))
+
+	palette := make(color.Palette, paletteSize)
+	for i := range palette {
+		palette[i] = color.RGBA{0, 0, 0, 255}
+	}
+
+	return &FrameBuffer{
+		rgba:    image.NewRGBA(rect),
+		indexed: image.NewPaletted(rect, palette),
+	}
+}
+
+func (f *FrameBuffer) SetPixel(x, y int, idx byte, c color.RGBA) {
+	if !(image.Point{x, y}.In(f.rgba.Rect)) {
+		return
+	}
+
+	f.rgba.SetRGBA(x, y, c)
+	f.indexed.SetColorIndex(x, y, idx)
+	f.indexed.Palette[idx] = c
+}
+
+func (f *FrameBuffer) EndFrame() {
+	f.Frames++
+}
+
+// RGBA returns the most recently rendered frame as an RGBA image.
+func (f *FrameBuffer) RGBA() *image.RGBA {
+	return f.rgba
+}
+
+// Paletted returns the most recently rendered frame, with each pixel being an
+// index into the NES system palette.
+func (f *FrameBuffer) Paletted() *image.Paletted {
+	return f.indexed
+}
@@ -1,9 +1,171 @@
 package nes
 
-// Mapper functions return whether or not the given address was successfully mapped.
+// Mapper is the hardware on a cartridge connecting its memory to the CPU and
+// PPU buses. Besides switching banks of PRG and CHR memory, mappers can hold
+// registers, own RAM, change the nametable mirroring (Cartridge.mirroring),
+// and interrupt the CPU.
+//
+// reference: https://wiki.nesdev.com/w/index.php/Mapper
 type Mapper interface {
-	cpuMapRead(uint16) uint16
-	cpuMapWrite(uint16) uint16
-	ppuMapRead(uint16) uint16
-	ppuMapWrite(uint16) uint16
+	// cpuRead reads from the cartridge's CPU address space ($4020-$FFFF).
+	// Returns false if the cartridge doesn't drive the data bus at the
+	// address, leaving the open bus value.
+	cpuRead(addr uint16) (byte, bool)
+
+	// cpuWrite writes to the cartridge's CPU address space. Writes to the
+	// PPU's registers ($2000-$3FFF) are also seen by the cartridge, for
+	// mappers watching them.
+	cpuWrite(addr uint16, data byte)
+
+	// ppuRead and ppuWrite access the pattern tables ($0000-$1FFF). Reads
+	// must not change the mapper's state, they are also used to draw the
+	// debug panel. See ppuAddress.
+	ppuRead(addr uint16) byte
+	ppuWrite(addr uint16, data byte)
+
+	// nametableRead and nametableWrite access the nametables ($2000-$2FFF),
+	// for mappers mapping them to their own memory. ciram is the NES's 2KB
+	// of nametable RAM. Return false to use the nametables selected by
+	// Cartridge.mirroring instead. Unlike ppuRead, reads are only made by
+	// the PPU, so they may change the mapper's state.
+	nametableRead(addr uint16, ciram *[2][1024]byte) (byte, bool)
+	nametableWrite(addr uint16, data byte, ciram *[2][1024]byte) bool
+
+	// ppuAddress is called whenever the PPU puts an address on its bus, for
+	// mappers watching the PPU's memory accesses (e.g. address line A12).
+	ppuAddress(addr uint16)
+
+	// chrFetched is called after the PPU reads from the pattern tables, for
+	// mappers switching banks depending on the tiles fetched.
+	chrFetched(addr uint16)
+
+	// ppuScanline is called at the start of each scanline, -1 to 260.
+	ppuScanline(scanline int, rendering bool)
+
+	// cpuClock is called every CPU cycle.
+	cpuClock()
+
+	// irq returns whether the mapper is asserting the CPU's IRQ line.
+	irq() bool
+
+	// saveState and loadState save the mapper's registers, see state.go.
+	saveState(e *stateEncoder)
+	loadState(d *stateDecoder)
+}
+
+// mapperConstructor creates a mapper for a cartridge, once its memory has been
+// loaded.
+type mapperConstructor func(c *Cartridge) Mapper
+
+// Mappers by iNES mapper ID, see registerMapper.
+var mapperRegistry = make(map[int]mapperConstructor)
+
+// registerMapper makes a mapper available to cartridges with the given mapper
+// ID. Mappers register themselves from init functions in their own files.
+func registerMapper(id int, newMapper mapperConstructor) {
+	if _, ok := mapperRegistry[id]; ok {
+		panic("nes: mapper registered twice")
+	}
+
+	mapperRegistry[id] = newMapper
+}
+
+// baseMapper provides the cartridge's memory to the mappers that embed it,
+// along with default implementations of the hooks most mappers don't need.
+type baseMapper struct {
+	cart *Cartridge
+}
+
+func (m *baseMapper) ppuAddress(addr uint16)                   {}
+func (m *baseMapper) chrFetched(addr uint16)                   {}
+func (m *baseMapper) ppuScanline(scanline int, rendering bool) {}
+func (m *baseMapper) cpuClock()                                {}
+func (m *baseMapper) irq() bool                                { return false }
+func (m *baseMapper) saveState(e *stateEncoder)                {}
+func (m *baseMapper) loadState(d *stateDecoder)                {}
+
+func (m *baseMapper) nametableRead(addr uint16, ciram *[2][1024]byte) (byte, bool) {
+	return 0, false
+}
+
+func (m *baseMapper) nametableWrite(addr uint16, data byte, ciram *[2][1024]byte) bool {
+	return false
+}
+
+// prgBanks returns the number of PRG ROM banks of the given size.
+func (m *baseMapper) prgBanks(size int) int {
+	return len(m.cart.prgMem) / size
+}
+
+// chrBanks returns the number of CHR banks of the given size.
+func (m *baseMapper) chrBanks(size int) int {
+	return len(m.cart.chrMem) / size
+}
+
+// readPrg reads from a bank of PRG ROM, of the given size in bytes. Banks past
+// the end of PRG ROM wrap around, as the unused bank bits are not connected.
+func (m *baseMapper) readPrg(bank, size int, addr uint16) byte {
+	prg := m.cart.prgMem
+
+	return prg[(bank*size+int(addr)%size)%len(prg)]
+}
+
+// readChr reads from a bank of CHR memory, of the given size in bytes.
+func (m *baseMapper) readChr(bank, size int, addr uint16) byte {
+	chr := m.cart.chrMem
+
+	return chr[(bank*size+int(addr)%size)%len(chr)]
+}
+
+// writeChr writes to a bank of CHR memory, if it is CHR RAM.
+func (m *baseMapper) writeChr(bank, size int, addr uint16, data byte) {
+	if !m.cart.chrIsRam {
+		return
+	}
+
+	chr := m.cart.chrMem
+	chr[(bank*size+int(addr)%size)%len(chr)] = data
+}
+
+// readPrgRam reads from a bank of PRG RAM at $6000-$7FFF, of the given size in
+// bytes. Without any PRG RAM reads return 0.
+func (m *baseMapper) readPrgRam(bank, size int, addr uint16) byte {
+	ram := m.cart.prgRam
+	if len(ram) == 0 {
+		return 0
+	}
+
+	return ram[(bank*size+int(addr-prgRamMinAddr)%size)%len(ram)]
+}
+
+// writePrgRam writes to a bank of PRG RAM at $6000-$7FFF.
+func (m *baseMapper) writePrgRam(bank, size int, addr uint16, data byte) {
+	ram := m.cart.prgRam
+	if len(ram) == 0 {
+		return
+	}
+
+	ram[(bank*size+int(addr-prgRamMinAddr)%size)%len(ram)] = data
+	m.cart.prgRamDirty = true
+}
+
+// Submapper of the discrete logic boards (UxROM, CNROM, AxROM) whose bank
+// registers are subject to bus conflicts. Submappers 0 (unspecified) and 1 are
+// emulated without them.
+const busConflictSubmapper int = 2
+
+// busConflicts returns whether writes to the cartridge's ROM area conflict
+// with the ROM, which outputs its data at the same time as the CPU.
+func (m *baseMapper) busConflicts() bool {
+	return m.cart.Info.Submapper == busConflictSubmapper
+}
+
+// busConflict returns the value seen by a register written at a ROM address.
+// With bus conflicts, each bit is 0 if either the CPU or the ROM drives it 0.
+func (m *baseMapper) busConflict(rom, data byte) byte {
+	if m.busConflicts() {
+		return rom & data
+	}
+
+	return data
 }
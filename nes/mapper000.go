@@ -1,61 +1,54 @@
 package nes
 
+// Mapper000 (NROM) has no bank switching: 16KB or 32KB of PRG ROM, 8KB of CHR
+// and optional PRG RAM.
+//
+// reference: https://wiki.nesdev.com/w/index.php/NROM
 type Mapper000 struct {
-	PrgBanks byte
-	ChrBanks byte
+	baseMapper
 }
 
-func NewMapper000(prgRomChunks, chrRomChunks byte) Mapper000 {
-	return Mapper000{
-		PrgBanks: prgRomChunks,
-		ChrBanks: chrRomChunks,
-	}
+func init() {
+	registerMapper(0, NewMapper000)
+}
+
+func NewMapper000(c *Cartridge) Mapper {
+	return &Mapper000{baseMapper{cart: c}}
 }
 
 // Address Mapping
 //
+// $6000-$7FFF -> PRG RAM
+//
 // if 16KB ROM size:
-// 	 0x8000-0xBFFF -> 0x0000-0x3FFF
-//   0xC000-0xFFFF -> 0x0000-0x3FFF (mirror)
+//   $8000-$BFFF -> $0000-$3FFF
+//   $C000-$FFFF -> $0000-$3FFF (mirror)
 //
 // if 32KB ROM size:
-//   0x8000-0xFFFF -> 0x0000-0x7FFF
-
-func (m Mapper000) cpuMapRead(addr uint16) uint16 {
-	if addr >= 0x8000 && addr <= 0xFFFF {
-		if m.PrgBanks > 1 {
-			addr &= 0x7FFF // 32KB ROM
-		} else {
-			addr &= 0x3FFF // 16KB ROM, need to mirror
-		}
+//   $8000-$FFFF -> $0000-$7FFF
+
+func (m *Mapper000) cpuRead(addr uint16) (byte, bool) {
+	if addr >= prgRomMinAddr {
+		return m.readPrg(0, len(m.cart.prgMem), addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		return m.cart.prgRamRead(addr), true
 	}
 
-	return addr
+	return 0, false
 }
 
-func (m Mapper000) cpuMapWrite(addr uint16) uint16 {
-	if addr >= 0x8000 && addr <= 0xFFFF {
-		if m.PrgBanks > 1 {
-			addr &= 0x3FFF // 16KB ROM, need to mirror
-		} else {
-			addr &= 0x7FFF // 32KB ROM
-		}
+// PRG ROM can't be written to.
+func (m *Mapper000) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		m.cart.prgRamWrite(addr, data)
 	}
-
-	return addr
 }
 
 // No PPU mapping
-func (m Mapper000) ppuMapRead(addr uint16) uint16 {
-	if addr >= 0x0000 && addr <= 0x1FFF {
-	}
-
-	return addr
+func (m *Mapper000) ppuRead(addr uint16) byte {
+	return m.readChr(0, len(m.cart.chrMem), addr)
 }
 
-func (m Mapper000) ppuMapWrite(addr uint16) uint16 {
-	if addr >= 0x0000 && addr <= 0x1FFF {
-	}
-
-	return addr
+func (m *Mapper000) ppuWrite(addr uint16, data byte) {
+	m.writeChr(0, len(m.cart.chrMem), addr, data)
 }
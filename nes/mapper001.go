@@ -0,0 +1,229 @@
+package nes
+
+// Mapper001 (MMC1) is written to one bit at a time through a serial shift
+// register. The fifth write to $8000-$FFFF copies the shifted value to one of
+// four internal registers, selected by address bits 13-14:
+//
+//	$8000-$9FFF: control (mirroring, PRG and CHR bank modes)
+//	$A000-$BFFF: CHR bank 0
+//	$C000-$DFFF: CHR bank 1
+//	$E000-$FFFF: PRG bank, and PRG RAM enable
+//
+// Boards with 512KB of PRG ROM (SUROM, SXROM) or more than 8KB of PRG RAM
+// (SOROM, SXROM) use the CHR bank registers' upper bits to select the outer
+// PRG ROM bank and the PRG RAM bank.
+//
+// reference: https://wiki.nesdev.com/w/index.php/MMC1
+type Mapper001 struct {
+	baseMapper
+
+	shift      byte // Serial shift register
+	shiftCount int  // Bits written to the shift register
+
+	control byte
+	chrBank [2]byte
+	prgBank byte
+
+	cycles    int // CPU cycles, to detect consecutive writes
+	lastWrite int // CPU cycle of the last write to the shift register
+
+	a12 int // PPU address line A12, selecting the CHR bank register in use
+}
+
+const (
+	mmc1PrgBankSize int = 16 * 1024
+	mmc1ChrBankSize int = 4 * 1024
+	mmc1RamBankSize int = 8 * 1024
+
+	mmc1ResetBit byte = 0x80 // Writes with bit 7 set reset the shift register
+)
+
+func init() {
+	registerMapper(1, NewMapper001)
+}
+
+func NewMapper001(c *Cartridge) Mapper {
+	m := &Mapper001{baseMapper: baseMapper{cart: c}}
+
+	// PRG mode 3 at power on, so that the reset vector is in the last bank.
+	m.control = 0x0C
+	m.lastWrite = -2
+
+	return m
+}
+
+func (m *Mapper001) cpuRead(addr uint16) (byte, bool) {
+	if addr >= prgRomMinAddr {
+		return m.readPrg(m.prgBankAt(addr), mmc1PrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if !m.prgRamEnabled() {
+			return 0, false
+		}
+		return m.readPrgRam(m.prgRamBank(), mmc1RamBankSize, addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper001) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRomMinAddr {
+		m.writeShift(addr, data)
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if m.prgRamEnabled() {
+			m.writePrgRam(m.prgRamBank(), mmc1RamBankSize, addr, data)
+		}
+	}
+}
+
+// writeShift shifts bit 0 of data into the shift register, LSB first.
+func (m *Mapper001) writeShift(addr uint16, data byte) {
+	// Writes on the cycle after another are ignored, so read-modify-write
+	// instructions only write the unmodified value.
+	consecutive := m.cycles-m.lastWrite <= 1
+	m.lastWrite = m.cycles
+	if consecutive {
+		return
+	}
+
+	if data&mmc1ResetBit > 0 {
+		m.shift = 0
+		m.shiftCount = 0
+		m.writeControl(m.control | 0x0C)
+		return
+	}
+
+	m.shift |= (data & 0x01) << m.shiftCount
+	m.shiftCount++
+	if m.shiftCount < 5 {
+		return
+	}
+
+	switch (addr >> 13) & 0x03 {
+	case 0:
+		m.writeControl(m.shift)
+	case 1:
+		m.chrBank[0] = m.shift
+	case 2:
+		m.chrBank[1] = m.shift
+	case 3:
+		m.prgBank = m.shift
+	}
+
+	m.shift = 0
+	m.shiftCount = 0
+}
+
+// Control register:
+//
+//	bits 0-1: mirroring (0: single-screen low, 1: single-screen high,
+//	          2: vertical, 3: horizontal)
+//	bits 2-3: PRG bank mode (0, 1: 32KB at $8000, 2: first bank fixed at
+//	          $8000, 3: last bank fixed at $C000)
+//	bit 4:    CHR bank mode (0: 8KB, 1: two 4KB banks)
+func (m *Mapper001) writeControl(data byte) {
+	m.control = data & 0x1F
+
+	switch m.control & 0x03 {
+	case 0:
+		m.cart.mirroring = mirrorOnescreenLo
+	case 1:
+		m.cart.mirroring = mirrorOnescreenHi
+	case 2:
+		m.cart.mirroring = mirrorVertical
+	case 3:
+		m.cart.mirroring = mirrorHorizontal
+	}
+}
+
+// prgBankAt returns the 16KB PRG ROM bank mapped at the given address.
+func (m *Mapper001) prgBankAt(addr uint16) int {
+	bank := int(m.prgBank & 0x0F)
+
+	switch (m.control >> 2) & 0x03 {
+	case 0, 1:
+		// 32KB, ignoring the low bit of the bank number
+		bank = bank&^1 | int(addr>>14)&1
+	case 2:
+		if addr < 0xC000 {
+			bank = 0
+		}
+	case 3:
+		if addr >= 0xC000 {
+			bank = 0x0F
+		}
+	}
+
+	// 512KB boards select the 256KB half of PRG ROM, which the fixed banks
+	// are also in, with bit 4 of the CHR bank.
+	if m.prgBanks(mmc1PrgBankSize) > 16 {
+		bank |= int(m.currentChrBank() & 0x10)
+	}
+
+	return bank
+}
+
+// prgRamBank returns the 8KB PRG RAM bank mapped at $6000, selected by bits
+// 2-3 of the CHR bank on SXROM (32KB) and bit 3 on SOROM (16KB).
+func (m *Mapper001) prgRamBank() int {
+	switch len(m.cart.prgRam) / mmc1RamBankSize {
+	case 4:
+		return int(m.currentChrBank()>>2) & 0x03
+	case 2:
+		return int(m.currentChrBank()>>3) & 0x01
+	}
+
+	return 0
+}
+
+// PRG RAM is enabled while bit 4 of the PRG bank is clear.
+func (m *Mapper001) prgRamEnabled() bool {
+	return m.prgBank&0x10 == 0
+}
+
+// currentChrBank returns the CHR bank register in use. In 4KB mode, this
+// depends on which pattern table the PPU last accessed.
+func (m *Mapper001) currentChrBank() byte {
+	if m.control&0x10 == 0 {
+		return m.chrBank[0]
+	}
+
+	return m.chrBank[m.a12]
+}
+
+// chrBankAt returns the 4KB CHR bank mapped at the given PPU address.
+func (m *Mapper001) chrBankAt(addr uint16) int {
+	if m.control&0x10 == 0 {
+		// 8KB, ignoring the low bit of the bank number
+		return int(m.chrBank[0]&^1) | int(addr>>12)&1
+	}
+
+	return int(m.chrBank[(addr>>12)&1])
+}
+
+func (m *Mapper001) ppuRead(addr uint16) byte {
+	return m.readChr(m.chrBankAt(addr), mmc1ChrBankSize, addr)
+}
+
+func (m *Mapper001) ppuWrite(addr uint16, data byte) {
+	m.writeChr(m.chrBankAt(addr), mmc1ChrBankSize, addr, data)
+}
+
+func (m *Mapper001) ppuAddress(addr uint16) {
+	m.a12 = int(addr>>12) & 1
+}
+
+func (m *Mapper001) cpuClock() {
+	m.cycles++
+}
+
+func (m *Mapper001) saveState(e *stateEncoder) {
+	e.write(m.shift, m.control, m.chrBank, m.prgBank)
+	e.writeInt(m.shiftCount, m.cycles-m.lastWrite, m.a12)
+}
+
+func (m *Mapper001) loadState(d *stateDecoder) {
+	var sinceWrite int
+	d.read(&m.shift, &m.control, &m.chrBank, &m.prgBank)
+	d.readInt(&m.shiftCount, &sinceWrite, &m.a12)
+	m.lastWrite = m.cycles - sinceWrite
+}
@@ -0,0 +1,59 @@
+package nes
+
+// Mapper002 (UxROM) switches a 16KB bank of PRG ROM at $8000, with the last
+// bank fixed at $C000. Writes to $8000-$FFFF select the bank.
+//
+// reference: https://wiki.nesdev.com/w/index.php/UxROM
+type Mapper002 struct {
+	baseMapper
+
+	prgBank byte
+}
+
+const uxromPrgBankSize int = 16 * 1024
+
+func init() {
+	registerMapper(2, NewMapper002)
+}
+
+func NewMapper002(c *Cartridge) Mapper {
+	return &Mapper002{baseMapper: baseMapper{cart: c}}
+}
+
+func (m *Mapper002) cpuRead(addr uint16) (byte, bool) {
+	if addr >= 0xC000 {
+		return m.readPrg(m.prgBanks(uxromPrgBankSize)-1, uxromPrgBankSize, addr), true
+	} else if addr >= prgRomMinAddr {
+		return m.readPrg(int(m.prgBank), uxromPrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper002) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRomMinAddr {
+		rom, _ := m.cpuRead(addr)
+		m.prgBank = m.busConflict(rom, data)
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		m.cart.prgRamWrite(addr, data)
+	}
+}
+
+// 8KB of CHR, usually RAM.
+func (m *Mapper002) ppuRead(addr uint16) byte {
+	return m.readChr(0, len(m.cart.chrMem), addr)
+}
+
+func (m *Mapper002) ppuWrite(addr uint16, data byte) {
+	m.writeChr(0, len(m.cart.chrMem), addr, data)
+}
+
+func (m *Mapper002) saveState(e *stateEncoder) {
+	e.write(m.prgBank)
+}
+
+func (m *Mapper002) loadState(d *stateDecoder) {
+	d.read(&m.prgBank)
+}
@@ -0,0 +1,56 @@
+package nes
+
+// Mapper003 (CNROM) switches an 8KB bank of CHR ROM. PRG ROM is mapped as on
+// NROM. Writes to $8000-$FFFF select the CHR bank.
+//
+// reference: https://wiki.nesdev.com/w/index.php/CNROM
+type Mapper003 struct {
+	baseMapper
+
+	chrBank byte
+}
+
+const cnromChrBankSize int = 8 * 1024
+
+func init() {
+	registerMapper(3, NewMapper003)
+}
+
+func NewMapper003(c *Cartridge) Mapper {
+	return &Mapper003{baseMapper: baseMapper{cart: c}}
+}
+
+func (m *Mapper003) cpuRead(addr uint16) (byte, bool) {
+	if addr >= prgRomMinAddr {
+		return m.readPrg(0, len(m.cart.prgMem), addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper003) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRomMinAddr {
+		rom, _ := m.cpuRead(addr)
+		m.chrBank = m.busConflict(rom, data)
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		m.cart.prgRamWrite(addr, data)
+	}
+}
+
+func (m *Mapper003) ppuRead(addr uint16) byte {
+	return m.readChr(int(m.chrBank), cnromChrBankSize, addr)
+}
+
+func (m *Mapper003) ppuWrite(addr uint16, data byte) {
+	m.writeChr(int(m.chrBank), cnromChrBankSize, addr, data)
+}
+
+func (m *Mapper003) saveState(e *stateEncoder) {
+	e.write(m.chrBank)
+}
+
+func (m *Mapper003) loadState(d *stateDecoder) {
+	d.read(&m.chrBank)
+}
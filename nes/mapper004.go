@@ -0,0 +1,239 @@
+package nes
+
+// Mapper004 (MMC3) switches 8KB banks of PRG ROM and 1KB/2KB banks of CHR,
+// and has a scanline counter which interrupts the CPU. Registers are selected
+// by address bits 13-14 and bit 0:
+//
+//	$8000: bank select (even), $8001: bank data (odd)
+//	$A000: mirroring (even),   $A001: PRG RAM protect (odd)
+//	$C000: IRQ latch (even),   $C001: IRQ reload (odd)
+//	$E000: IRQ disable (even), $E001: IRQ enable (odd)
+//
+// The scanline counter is clocked by rising edges of PPU address line A12,
+// which happen once per scanline when the background and sprites use
+// different pattern tables.
+//
+// reference: https://wiki.nesdev.com/w/index.php/MMC3
+type Mapper004 struct {
+	baseMapper
+
+	bankSelect byte
+	banks      [8]byte // R0-R7, selected by bank select bits 0-2
+	ramProtect byte
+
+	irqLatch   byte
+	irqCounter byte
+	irqReload  bool // Reload the counter on its next clock
+	irqEnabled bool
+	irqLine    bool
+
+	a12     bool // Last level of PPU address line A12
+	a12Low  int  // CPU cycles A12 has been low for
+	altIrqs bool // MMC3A behaviour, see clockCounter
+}
+
+const (
+	mmc3PrgBankSize int = 8 * 1024
+	mmc3ChrBankSize int = 1024
+
+	// CPU cycles A12 must be low for before a rising edge clocks the
+	// counter. This filters out the edges between tiles, when the PPU
+	// fetches nametables between pattern table fetches.
+	mmc3A12Filter int = 4
+
+	// NES 2.0 submapper of boards with MMC3A's IRQ behaviour.
+	mmc3ASubmapper int = 4
+)
+
+func init() {
+	registerMapper(4, NewMapper004)
+}
+
+func NewMapper004(c *Cartridge) Mapper {
+	return &Mapper004{
+		baseMapper: baseMapper{cart: c},
+		ramProtect: 0x80,
+		altIrqs:    c.Info.Submapper == mmc3ASubmapper,
+	}
+}
+
+func (m *Mapper004) cpuRead(addr uint16) (byte, bool) {
+	if addr >= prgRomMinAddr {
+		return m.readPrg(m.prgBankAt(addr), mmc3PrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if m.ramProtect&0x80 == 0 {
+			return 0, false
+		}
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper004) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		// Bit 7 enables PRG RAM, bit 6 protects it from writes.
+		if m.ramProtect&0xC0 == 0x80 {
+			m.cart.prgRamWrite(addr, data)
+		}
+		return
+	} else if addr < prgRomMinAddr {
+		return
+	}
+
+	even := addr&1 == 0
+	switch addr & 0xE000 {
+	case 0x8000:
+		if even {
+			m.bankSelect = data
+		} else {
+			m.banks[m.bankSelect&0x07] = data
+		}
+	case 0xA000:
+		if even {
+			if m.cart.mirroring == mirrorFourScreen {
+				break
+			}
+			if data&0x01 == 0 {
+				m.cart.mirroring = mirrorVertical
+			} else {
+				m.cart.mirroring = mirrorHorizontal
+			}
+		} else {
+			m.ramProtect = data
+		}
+	case 0xC000:
+		if even {
+			m.irqLatch = data
+		} else {
+			m.irqCounter = 0
+			m.irqReload = true
+		}
+	case 0xE000:
+		if even {
+			m.irqEnabled = false
+			m.irqLine = false
+		} else {
+			m.irqEnabled = true
+		}
+	}
+}
+
+// prgBankAt returns the 8KB PRG ROM bank mapped at the given address. Bit 6 of
+// bank select swaps $8000 and $C000:
+//
+//	         $8000  $A000  $C000  $E000
+//	mode 0:  R6     R7     -2     -1
+//	mode 1:  -2     R7     R6     -1
+//
+// where -1 is the last bank and -2 the second last.
+func (m *Mapper004) prgBankAt(addr uint16) int {
+	last := m.prgBanks(mmc3PrgBankSize) - 1
+	slot := int(addr-prgRomMinAddr) / mmc3PrgBankSize
+
+	if m.bankSelect&0x40 > 0 && slot&1 == 0 {
+		slot ^= 2
+	}
+
+	switch slot {
+	case 0:
+		return int(m.banks[6] & 0x3F)
+	case 1:
+		return int(m.banks[7] & 0x3F)
+	case 2:
+		return last - 1
+	}
+
+	return last
+}
+
+// chrBankAt returns the 1KB CHR bank mapped at the given address. Bit 7 of
+// bank select swaps $0000-$0FFF and $1000-$1FFF:
+//
+//	$0000-$07FF: R0 (2KB)
+//	$0800-$0FFF: R1 (2KB)
+//	$1000-$13FF: R2
+//	$1400-$17FF: R3
+//	$1800-$1BFF: R4
+//	$1C00-$1FFF: R5
+func (m *Mapper004) chrBankAt(addr uint16) int {
+	if m.bankSelect&0x80 > 0 {
+		addr ^= 0x1000
+	}
+
+	slot := int(addr&0x1FFF) / mmc3ChrBankSize
+	if slot < 4 {
+		// 2KB banks ignore the low bit of the bank number
+		return int(m.banks[slot/2]&^1) | slot&1
+	}
+
+	return int(m.banks[slot-2])
+}
+
+func (m *Mapper004) ppuRead(addr uint16) byte {
+	return m.readChr(m.chrBankAt(addr), mmc3ChrBankSize, addr)
+}
+
+func (m *Mapper004) ppuWrite(addr uint16, data byte) {
+	m.writeChr(m.chrBankAt(addr), mmc3ChrBankSize, addr, data)
+}
+
+func (m *Mapper004) ppuAddress(addr uint16) {
+	a12 := addr&0x1000 > 0
+	if a12 && !m.a12 && m.a12Low >= mmc3A12Filter {
+		m.clockCounter()
+	}
+	if a12 {
+		m.a12Low = 0
+	}
+
+	m.a12 = a12
+}
+
+func (m *Mapper004) cpuClock() {
+	if !m.a12 {
+		m.a12Low++
+	}
+}
+
+// clockCounter reloads the scanline counter when it is 0, otherwise counts it
+// down, interrupting the CPU once it reaches 0.
+//
+// MMC3A doesn't interrupt when the counter is reloaded with 0, unless the
+// reload was requested by a write to $C001. Later revisions interrupt every
+// clock while the latch is 0.
+func (m *Mapper004) clockCounter() {
+	wasZero := m.irqCounter == 0
+	reload := m.irqReload
+
+	if wasZero || reload {
+		m.irqCounter = m.irqLatch
+	} else {
+		m.irqCounter--
+	}
+	m.irqReload = false
+
+	if m.irqCounter == 0 && m.irqEnabled {
+		if !m.altIrqs || !wasZero || reload {
+			m.irqLine = true
+		}
+	}
+}
+
+func (m *Mapper004) irq() bool {
+	return m.irqLine
+}
+
+func (m *Mapper004) saveState(e *stateEncoder) {
+	e.write(m.bankSelect, m.banks, m.ramProtect)
+	e.write(m.irqLatch, m.irqCounter, m.irqReload, m.irqEnabled, m.irqLine)
+	e.write(m.a12)
+	e.writeInt(m.a12Low)
+}
+
+func (m *Mapper004) loadState(d *stateDecoder) {
+	d.read(&m.bankSelect, &m.banks, &m.ramProtect)
+	d.read(&m.irqLatch, &m.irqCounter, &m.irqReload, &m.irqEnabled, &m.irqLine)
+	d.read(&m.a12)
+	d.readInt(&m.a12Low)
+}
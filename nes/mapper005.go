@@ -0,0 +1,544 @@
+package nes
+
+// Mapper005 (MMC5) switches PRG ROM and RAM in up to four 8KB banks, and CHR
+// in up to eight 1KB banks, with a second set of CHR banks for the background
+// when sprites are 8x16. It has 1KB of its own RAM (ExRAM), maps each of the
+// four nametables to CIRAM, ExRAM or a fill tile, and can use ExRAM for a
+// vertical split screen or for per-tile background banks and palettes. Its
+// registers are at $5000-$5FFF:
+//
+//	$5000-$5015: expansion audio, see mmc5Audio
+//	$5100-$5107: PRG/CHR modes, PRG RAM protect, ExRAM mode, nametables, fill
+//	$5113-$5117: PRG banks
+//	$5120-$5130: CHR banks
+//	$5200-$5206: vertical split, scanline IRQ, multiplier
+//	$5C00-$5FFF: ExRAM
+//
+// The MMC5 can't see the PPU's scanline, it works it out from the PPU's
+// fetches instead, see nametableRead. It also watches writes to PPUCTRL for
+// the sprite size.
+//
+// reference: https://wiki.nesdev.com/w/index.php/MMC5
+type Mapper005 struct {
+	baseMapper
+
+	prgMode    byte    // $5100
+	chrMode    byte    // $5101
+	ramProtect [2]byte // $5102-$5103, PRG RAM is writable when they are 2 and 1
+	exramMode  byte    // $5104
+	nametables byte    // $5105, 2 bits per nametable
+	fillTile   byte    // $5106
+	fillAttr   byte    // $5107
+
+	prgRegs  [5]byte    // $5113-$5117
+	chrRegs  [12]uint16 // $5120-$512B, with the upper bits from $5130
+	chrUpper byte       // $5130
+	chrSetB  bool       // Whether $5128-$512B were written last
+
+	exram [1024]byte
+
+	splitCtrl   byte // $5200
+	splitScroll byte // $5201
+	splitBank   byte // $5202
+
+	irqTarget  byte // $5203
+	irqEnabled bool
+	irqPending bool
+	inFrame    bool // Whether the PPU is rendering a frame
+	scanline   int  // Scanlines detected since the start of the frame
+
+	multiplicand byte // $5205
+	multiplier   byte // $5206
+
+	sprites8x16 bool // PPUCTRL bit 5
+
+	// PPU fetch tracking
+	rendering bool   // Rendering a visible scanline, or the pre-render one
+	lastRead  uint16 // Last address read by the PPU
+	sameReads int    // Consecutive reads repeating lastRead
+	idle      int    // CPU cycles since the PPU last read
+	tile      int    // Column of the background tile being fetched
+	fetchLine int    // Scanline the background tile is for
+	tileSplit bool   // Background tile is in the split region
+	splitY    int    // Split region's Y scroll for the background tile
+	tileExt   byte   // ExRAM byte of the background tile
+
+	audio mmc5Audio
+}
+
+const (
+	mmc5PrgBankSize   int = 8 * 1024
+	mmc5ChrBankSize   int = 1024
+	mmc5SplitBankSize int = 4 * 1024
+
+	// The MMC5 leaves the frame once the PPU hasn't read for 3 CPU cycles.
+	mmc5IdleCycles int = 3
+
+	// Background tiles fetched each scanline: 32 visible ones, 2 fetched for
+	// the next scanline, and 1 unused at the start of the sprite fetches.
+	mmc5SpriteTile int = 34
+	mmc5LineTiles  int = 35
+)
+
+func init() {
+	registerMapper(5, NewMapper005)
+}
+
+func NewMapper005(c *Cartridge) Mapper {
+	m := &Mapper005{
+		baseMapper: baseMapper{cart: c},
+		prgMode:    3,
+		chrMode:    3,
+		audio:      newMmc5Audio(),
+	}
+
+	// The reset vector is in the last bank at power on.
+	m.prgRegs[4] = 0xFF
+
+	return m
+}
+
+func (m *Mapper005) cpuRead(addr uint16) (byte, bool) {
+	switch {
+	case addr >= prgRomMinAddr:
+		// The CPU reads the NMI vector at the end of the frame.
+		if addr == 0xFFFA || addr == 0xFFFB {
+			m.inFrame = false
+		}
+
+		bank, rom := m.prgBankAt(addr)
+		if !rom {
+			return m.readPrgRam(bank, mmc5PrgBankSize, addr), true
+		}
+
+		data := m.readPrg(bank, mmc5PrgBankSize, addr)
+		if addr < 0xC000 {
+			m.audio.pcmRead(data)
+		}
+		return data, true
+	case addr >= prgRamMinAddr && addr <= prgRamMaxAddr:
+		return m.readPrgRam(int(m.prgRegs[0]&0x07), mmc5PrgBankSize, addr), true
+	case addr >= 0x5C00:
+		// ExRAM is only readable by the CPU in modes 2 and 3.
+		if m.exramMode < 2 {
+			return 0, false
+		}
+		return m.exram[addr-0x5C00], true
+	case addr == 0x5204:
+		// IRQ status: IRQ pending (bit 7) and in frame (bit 6). Reading
+		// acknowledges the IRQ.
+		var data byte
+		if m.irqPending {
+			data |= 0x80
+		}
+		if m.inFrame {
+			data |= 0x40
+		}
+		m.irqPending = false
+		return data, true
+	case addr == 0x5205:
+		return byte(uint16(m.multiplicand) * uint16(m.multiplier)), true
+	case addr == 0x5206:
+		return byte(uint16(m.multiplicand) * uint16(m.multiplier) >> 8), true
+	case addr >= 0x5000 && addr <= 0x5015:
+		return m.audio.read(addr)
+	}
+
+	return 0, false
+}
+
+func (m *Mapper005) cpuWrite(addr uint16, data byte) {
+	switch {
+	case addr < cartMinAddr:
+		m.watchPpu(addr, data)
+	case addr >= prgRomMinAddr:
+		if bank, rom := m.prgBankAt(addr); !rom && m.prgRamWritable() {
+			m.writePrgRam(bank, mmc5PrgBankSize, addr, data)
+		}
+	case addr >= prgRamMinAddr && addr <= prgRamMaxAddr:
+		if m.prgRamWritable() {
+			m.writePrgRam(int(m.prgRegs[0]&0x07), mmc5PrgBankSize, addr, data)
+		}
+	case addr >= 0x5C00:
+		m.writeExram(addr-0x5C00, data)
+	case addr >= 0x5000 && addr <= 0x5015:
+		m.audio.write(addr, data)
+	case addr >= 0x5113 && addr <= 0x5117:
+		m.prgRegs[addr-0x5113] = data
+	case addr >= 0x5120 && addr <= 0x512B:
+		m.chrRegs[addr-0x5120] = uint16(m.chrUpper)<<8 | uint16(data)
+		m.chrSetB = addr >= 0x5128
+	}
+
+	switch addr {
+	case 0x5100:
+		m.prgMode = data & 0x03
+	case 0x5101:
+		m.chrMode = data & 0x03
+	case 0x5102, 0x5103:
+		m.ramProtect[addr-0x5102] = data & 0x03
+	case 0x5104:
+		m.exramMode = data & 0x03
+	case 0x5105:
+		m.nametables = data
+	case 0x5106:
+		m.fillTile = data
+	case 0x5107:
+		m.fillAttr = data & 0x03
+	case 0x5130:
+		m.chrUpper = data & 0x03
+	case 0x5200:
+		m.splitCtrl = data
+	case 0x5201:
+		m.splitScroll = data
+	case 0x5202:
+		m.splitBank = data
+	case 0x5203:
+		m.irqTarget = data
+	case 0x5204:
+		m.irqEnabled = data&0x80 > 0
+	case 0x5205:
+		m.multiplicand = data
+	case 0x5206:
+		m.multiplier = data
+	}
+}
+
+// watchPpu follows writes to PPUCTRL for the sprite size, and to PPUMASK,
+// which leaves the frame when rendering is disabled.
+func (m *Mapper005) watchPpu(addr uint16, data byte) {
+	switch addr & ppuMirror {
+	case 0x0000:
+		m.sprites8x16 = data&0x20 > 0
+	case 0x0001:
+		if data&0x18 == 0 {
+			m.inFrame = false
+		}
+	}
+}
+
+// writeExram writes to ExRAM from the CPU. In modes 0 and 1, where ExRAM is
+// used by the PPU, writes outside of rendering write 0. It is read-only in
+// mode 3.
+func (m *Mapper005) writeExram(addr uint16, data byte) {
+	switch m.exramMode {
+	case 0, 1:
+		if !m.inFrame {
+			data = 0
+		}
+	case 3:
+		return
+	}
+
+	m.exram[addr] = data
+}
+
+// PRG RAM is writable once $5102 is set to 2 and $5103 to 1.
+func (m *Mapper005) prgRamWritable() bool {
+	return m.ramProtect[0] == 2 && m.ramProtect[1] == 1
+}
+
+// prgBankAt returns the 8KB bank mapped at the given address, and whether it
+// is a bank of ROM rather than RAM. Bit 7 of $5114-$5116 selects ROM, $5117 is
+// always ROM:
+//
+//	         $8000  $A000  $C000  $E000
+//	mode 0:  $5117 (32KB)
+//	mode 1:  $5115 (16KB)  $5117 (16KB)
+//	mode 2:  $5115 (16KB)  $5116  $5117
+//	mode 3:  $5114  $5115  $5116  $5117
+func (m *Mapper005) prgBankAt(addr uint16) (int, bool) {
+	slot := int(addr-prgRomMinAddr) / mmc5PrgBankSize
+
+	var reg byte
+	switch {
+	case m.prgMode == 0:
+		return int(m.prgRegs[4]&0x7C) | slot, true
+	case m.prgMode == 1 && slot >= 2:
+		return int(m.prgRegs[4]&0x7E) | slot&1, true
+	case m.prgMode < 3 && slot < 2:
+		reg = m.prgRegs[2]&0xFE | byte(slot)
+	default:
+		reg = m.prgRegs[slot+1]
+	}
+
+	if slot == 3 {
+		return int(reg & 0x7F), true
+	}
+
+	return int(reg & 0x7F), reg&0x80 > 0
+}
+
+// chrBankAt returns the 1KB CHR bank mapped at the given address, from CHR
+// bank set A ($5120-$5127) or B ($5128-$512B). Set B only covers 4KB, which
+// is mirrored at $0000 and $1000 except in 8KB mode:
+//
+//	         $0000        $0800   $1000        $1800
+//	mode 0:  $5127/$512B (8KB)
+//	mode 1:  $5123/$512B          $5127/$512B          (4KB)
+//	mode 2:  $5121/$5129  $5123/$512B  $5125/$5129  $5127/$512B
+//	mode 3:  $5120-$5127, $5128-$512B (1KB)
+func (m *Mapper005) chrBankAt(addr uint16, setB bool) int {
+	addr &= patternTblAddrEnd
+	if setB && m.chrMode > 0 {
+		addr &= 0x0FFF
+	}
+
+	var reg int
+	switch m.chrMode {
+	case 0:
+		reg = 7
+	case 1:
+		reg = int(addr>>12)*4 + 3
+	case 2:
+		reg = int(addr>>11)*2 + 1
+	case 3:
+		reg = int(addr >> 10)
+	}
+	if setB {
+		reg = 8 + reg&0x03
+	}
+
+	size := 8 * 1024 >> m.chrMode
+	return int(m.chrRegs[reg])*(size/mmc5ChrBankSize) + int(addr)%size/mmc5ChrBankSize
+}
+
+// useChrSetB returns whether the PPU's pattern table accesses use CHR bank
+// set B. With 8x16 sprites, the background uses set B while rendering.
+// Otherwise the set written to last is used.
+func (m *Mapper005) useChrSetB() bool {
+	if !m.sprites8x16 || !m.rendering {
+		return m.chrSetB
+	}
+
+	return m.tile != mmc5SpriteTile
+}
+
+// backgroundFetch returns whether the PPU is fetching a background tile.
+func (m *Mapper005) backgroundFetch() bool {
+	return m.rendering && m.tile != mmc5SpriteTile
+}
+
+func (m *Mapper005) ppuRead(addr uint16) byte {
+	if m.backgroundFetch() {
+		if m.tileSplit {
+			// The split region's own fine Y scroll
+			addr = addr&0x0FF8 | uint16(m.splitY&0x07)
+			return m.readChr(int(m.splitBank), mmc5SplitBankSize, addr)
+		} else if m.exramMode == 1 {
+			// Extended attributes: a 4KB bank for each tile
+			bank := int(m.chrUpper)<<6 | int(m.tileExt&0x3F)
+			return m.readChr(bank, 4*1024, addr)
+		}
+	}
+
+	return m.readChr(m.chrBankAt(addr, m.useChrSetB()), mmc5ChrBankSize, addr)
+}
+
+func (m *Mapper005) ppuWrite(addr uint16, data byte) {
+	m.writeChr(m.chrBankAt(addr, m.chrSetB), mmc5ChrBankSize, addr, data)
+}
+
+// nametableRead reads from the nametable mapped by $5105. Each read is also
+// used to follow the PPU's rendering:
+//
+// A new scanline starts when the PPU reads the same nametable address 3 times
+// in a row, which it only does at the end of each scanline: the 3rd tile of
+// the next scanline is fetched along with 2 unused fetches of it. The first
+// scanline detected puts the MMC5 in the frame, and the following ones count
+// up the scanline IRQ's counter.
+//
+// Counting the nametable fetches since the start of the scanline gives the
+// column of each background tile, for the split screen, and tells the
+// background's fetches apart from the sprites'.
+func (m *Mapper005) nametableRead(addr uint16, ciram *[2][1024]byte) (byte, bool) {
+	if addr == m.lastRead {
+		m.sameReads++
+		if m.sameReads == 2 {
+			m.detectScanline()
+		}
+	} else {
+		m.sameReads = 0
+		if addr&0x03FF < 0x03C0 {
+			m.fetchTile(addr)
+		}
+	}
+	m.lastRead = addr
+	m.idle = 0
+
+	if m.backgroundFetch() {
+		if m.tileSplit {
+			return m.splitNametable(addr), true
+		} else if m.exramMode == 1 && addr&0x03FF >= 0x03C0 {
+			// Extended attributes: a palette for each tile
+			return (m.tileExt >> 6) * 0x55, true
+		}
+	}
+
+	offset := addr & 0x03FF
+	switch m.nametableSource(addr) {
+	case 0, 1:
+		return ciram[m.nametableSource(addr)][offset], true
+	case 2:
+		if m.exramMode >= 2 {
+			return 0, true
+		}
+		return m.exram[offset], true
+	}
+
+	// Fill mode
+	if offset >= 0x03C0 {
+		return m.fillAttr * 0x55, true
+	}
+	return m.fillTile, true
+}
+
+func (m *Mapper005) nametableWrite(addr uint16, data byte, ciram *[2][1024]byte) bool {
+	offset := addr & 0x03FF
+	switch m.nametableSource(addr) {
+	case 0, 1:
+		ciram[m.nametableSource(addr)][offset] = data
+	case 2:
+		if m.exramMode < 2 {
+			m.exram[offset] = data
+		}
+	}
+
+	return true
+}
+
+// nametableSource returns the memory the nametable at the given address is
+// mapped to: 0 or 1 for CIRAM's two pages, 2 for ExRAM and 3 for fill mode.
+func (m *Mapper005) nametableSource(addr uint16) byte {
+	return m.nametables >> ((addr >> 9) & 0x06) & 0x03
+}
+
+// fetchTile follows a background tile's nametable fetch, which starts the
+// fetches for the next tile.
+func (m *Mapper005) fetchTile(addr uint16) {
+	m.tile++
+	if m.tile == mmc5LineTiles {
+		// Tiles for the next scanline
+		m.tile = 0
+		m.fetchLine++
+	}
+	m.updateTile(addr)
+}
+
+// updateTile decides how the background tile at the given nametable address is
+// drawn, for the split screen and extended attributes.
+func (m *Mapper005) updateTile(addr uint16) {
+	m.tileExt = m.exram[addr&0x03FF]
+	m.tileSplit = false
+
+	if m.splitCtrl&0x80 == 0 || m.exramMode >= 2 || m.tile >= 32 {
+		return
+	}
+
+	// Bits 0-4 give the tile the split starts or ends at, bit 6 selects
+	// the right side.
+	threshold := int(m.splitCtrl & 0x1F)
+	if m.splitCtrl&0x40 > 0 {
+		m.tileSplit = m.tile >= threshold
+	} else {
+		m.tileSplit = m.tile < threshold
+	}
+
+	// The split region scrolls separately, wrapping at the bottom of the
+	// 30 rows of tiles.
+	m.splitY = (int(m.splitScroll) + m.fetchLine) % 240
+	if m.splitY < 0 {
+		m.splitY += 240
+	}
+}
+
+// splitNametable reads the split region's nametable, which is ExRAM.
+// Attributes repeat the tile's palette, as the PPU's own scroll picks which
+// quarter of the attribute byte it uses.
+func (m *Mapper005) splitNametable(addr uint16) byte {
+	row := m.splitY / 8
+	if addr&0x03FF < 0x03C0 {
+		return m.exram[row*32+m.tile]
+	}
+
+	attr := m.exram[0x03C0+row/4*8+m.tile/4]
+	shift := (row&0x02)<<1 | m.tile&0x02
+	return (attr >> shift & 0x03) * 0x55
+}
+
+// detectScanline is called at the end of each scanline the PPU renders.
+func (m *Mapper005) detectScanline() {
+	if !m.inFrame {
+		m.inFrame = true
+		m.scanline = 0
+		m.irqPending = false
+	} else {
+		m.scanline++
+		if m.scanline == int(m.irqTarget) {
+			m.irqPending = true
+		}
+	}
+
+	// The repeated fetch is for the next scanline's 3rd tile.
+	m.updateTile(m.lastRead)
+}
+
+func (m *Mapper005) chrFetched(addr uint16) {
+	m.lastRead = addr
+	m.sameReads = 0
+	m.idle = 0
+}
+
+// ppuScanline resynchronises the tile count with the PPU at the start of each
+// scanline, after the fetches of its first 3 tiles.
+func (m *Mapper005) ppuScanline(scanline int, rendering bool) {
+	m.rendering = rendering && scanline < 240
+	m.tile = 2
+	m.fetchLine = scanline
+}
+
+func (m *Mapper005) cpuClock() {
+	m.idle++
+	if m.idle >= mmc5IdleCycles {
+		m.inFrame = false
+	}
+
+	m.audio.clock()
+}
+
+func (m *Mapper005) irq() bool {
+	return m.irqPending && m.irqEnabled || m.audio.irq()
+}
+
+// audioOutput is the mix of the MMC5's pulse and PCM channels.
+func (m *Mapper005) audioOutput() float32 {
+	return m.audio.output()
+}
+
+func (m *Mapper005) maxAudioOutput() float32 {
+	return m.audio.maxOutput()
+}
+
+func (m *Mapper005) saveState(e *stateEncoder) {
+	e.write(m.prgMode, m.chrMode, m.ramProtect, m.exramMode, m.nametables,
+		m.fillTile, m.fillAttr)
+	e.write(m.prgRegs, m.chrRegs, m.chrUpper, m.chrSetB, m.exram)
+	e.write(m.splitCtrl, m.splitScroll, m.splitBank)
+	e.write(m.irqTarget, m.irqEnabled, m.irqPending, m.inFrame)
+	e.write(m.multiplicand, m.multiplier, m.sprites8x16)
+	e.write(m.rendering, m.lastRead, m.tileSplit, m.tileExt)
+	e.writeInt(m.scanline, m.sameReads, m.idle, m.tile, m.fetchLine, m.splitY)
+	m.audio.saveState(e)
+}
+
+func (m *Mapper005) loadState(d *stateDecoder) {
+	d.read(&m.prgMode, &m.chrMode, &m.ramProtect, &m.exramMode, &m.nametables,
+		&m.fillTile, &m.fillAttr)
+	d.read(&m.prgRegs, &m.chrRegs, &m.chrUpper, &m.chrSetB, &m.exram)
+	d.read(&m.splitCtrl, &m.splitScroll, &m.splitBank)
+	d.read(&m.irqTarget, &m.irqEnabled, &m.irqPending, &m.inFrame)
+	d.read(&m.multiplicand, &m.multiplier, &m.sprites8x16)
+	d.read(&m.rendering, &m.lastRead, &m.tileSplit, &m.tileExt)
+	d.readInt(&m.scanline, &m.sameReads, &m.idle, &m.tile, &m.fetchLine, &m.splitY)
+	m.audio.loadState(d)
+}
@@ -0,0 +1,163 @@
+package nes
+
+// mmc5Audio is the MMC5's expansion audio: 2 pulse channels like the APU's,
+// and an 8-bit PCM channel. Its registers are:
+//
+//	$5000-$5003: pulse 1, as $4000-$4003 without the sweep unit
+//	$5004-$5007: pulse 2
+//	$5010:       PCM IRQ enable (bit 7) and read mode (bit 0)
+//	$5011:       PCM level, in write mode
+//	$5015:       pulse length counter enables and status
+//
+// In read mode the PCM level is set by the CPU's reads from $8000-$BFFF, and
+// reading 0 interrupts the CPU instead. The envelopes and length counters are
+// clocked at a fixed 240Hz, rather than by the APU's frame counter.
+//
+// reference: https://wiki.nesdev.com/w/index.php/MMC5_audio
+type mmc5Audio struct {
+	pulse [2]mmc5Pulse
+
+	pcm           byte // PCM channel's level
+	pcmReadMode   bool
+	pcmIrqEnabled bool
+	pcmIrq        bool
+
+	oddCycle   bool // Pulse timers are clocked every other CPU cycle
+	frameTimer int  // CPU cycles until the envelopes and length counters are clocked
+}
+
+// CPU cycles between clocks of the envelopes and length counters, 240Hz.
+const mmc5FrameCycles int = 7457
+
+// mmc5Pulse is one of the MMC5's pulse channels, an APU pulse channel whose
+// sweep unit is never enabled. Without it, high and low timer periods don't
+// silence the channel.
+type mmc5Pulse struct {
+	apuPulse
+}
+
+func newMmc5Audio() mmc5Audio {
+	return mmc5Audio{
+		pulse:      [2]mmc5Pulse{{apuPulse{channel: 1}}, {apuPulse{channel: 2}}},
+		frameTimer: mmc5FrameCycles,
+	}
+}
+
+func (a *mmc5Audio) read(addr uint16) (byte, bool) {
+	var data byte
+
+	switch addr {
+	case 0x5010:
+		// Reading acknowledges the PCM IRQ.
+		if a.pcmIrq {
+			data |= 0x80
+		}
+		a.pcmIrq = false
+	case 0x5015:
+		if a.pulse[0].length.counter > 0 {
+			data |= 0x01
+		}
+		if a.pulse[1].length.counter > 0 {
+			data |= 0x02
+		}
+	default:
+		return 0, false
+	}
+
+	return data, true
+}
+
+func (a *mmc5Audio) write(addr uint16, data byte) {
+	switch {
+	case addr <= 0x5007:
+		// The sweep registers, $5001 and $5005, do nothing.
+		reg := (addr - 0x5000) & 0x03
+		if reg != 1 {
+			a.pulse[(addr-0x5000)/4].write(reg, data)
+		}
+	case addr == 0x5010:
+		a.pcmReadMode = data&0x01 > 0
+		a.pcmIrqEnabled = data&0x80 > 0
+	case addr == 0x5011:
+		// Writing 0 is ignored.
+		if !a.pcmReadMode && data != 0 {
+			a.pcm = data
+		}
+	case addr == 0x5015:
+		a.pulse[0].length.setEnabled(data&0x01 > 0)
+		a.pulse[1].length.setEnabled(data&0x02 > 0)
+	}
+}
+
+// pcmRead is called with the data of CPU reads from $8000-$BFFF.
+func (a *mmc5Audio) pcmRead(data byte) {
+	if !a.pcmReadMode {
+		return
+	}
+
+	if data == 0 {
+		a.pcmIrq = true
+	} else {
+		a.pcm = data
+	}
+}
+
+func (a *mmc5Audio) irq() bool {
+	return a.pcmIrq && a.pcmIrqEnabled
+}
+
+// clock is called every CPU cycle.
+func (a *mmc5Audio) clock() {
+	a.oddCycle = !a.oddCycle
+	if a.oddCycle {
+		a.pulse[0].clockTimer()
+		a.pulse[1].clockTimer()
+	}
+
+	a.frameTimer--
+	if a.frameTimer == 0 {
+		a.frameTimer = mmc5FrameCycles
+		for i := range a.pulse {
+			a.pulse[i].envelope.clock()
+			a.pulse[i].length.clock()
+		}
+	}
+}
+
+// output mixes the pulse channels like the APU's, and the PCM channel like
+// the DMC, whose levels are 7-bit.
+func (a *mmc5Audio) output() float32 {
+	return pulseMixTable[a.pulse[0].output()+a.pulse[1].output()] +
+		tndMixTable[a.pcm>>1]
+}
+
+// maxOutput returns output's highest level, with both pulse channels at
+// volume 15 and the PCM channel at 255.
+func (a *mmc5Audio) maxOutput() float32 {
+	return pulseMixTable[30] + tndMixTable[127]
+}
+
+func (a *mmc5Audio) saveState(e *stateEncoder) {
+	for i := range a.pulse {
+		a.pulse[i].saveState(e)
+	}
+	e.write(a.pcm, a.pcmReadMode, a.pcmIrqEnabled, a.pcmIrq, a.oddCycle)
+	e.writeInt(a.frameTimer)
+}
+
+func (a *mmc5Audio) loadState(d *stateDecoder) {
+	for i := range a.pulse {
+		a.pulse[i].loadState(d)
+	}
+	d.read(&a.pcm, &a.pcmReadMode, &a.pcmIrqEnabled, &a.pcmIrq, &a.oddCycle)
+	d.readInt(&a.frameTimer)
+}
+
+// output returns the channel's current volume, 0-15.
+func (p *mmc5Pulse) output() byte {
+	if p.length.counter == 0 || pulseDutyTable[p.duty][p.sequence] == 0 {
+		return 0
+	}
+
+	return p.envelope.output()
+}
@@ -0,0 +1,69 @@
+package nes
+
+// Mapper007 (AxROM) switches 32KB banks of PRG ROM, and selects which
+// nametable is used for single-screen mirroring. Writes to $8000-$FFFF set:
+//
+//	bits 0-2: PRG bank
+//	bit 4:    nametable (0: low, 1: high)
+//
+// reference: https://wiki.nesdev.com/w/index.php/AxROM
+type Mapper007 struct {
+	baseMapper
+
+	prgBank byte
+}
+
+const axromPrgBankSize int = 32 * 1024
+
+func init() {
+	registerMapper(7, NewMapper007)
+}
+
+func NewMapper007(c *Cartridge) Mapper {
+	c.mirroring = mirrorOnescreenLo
+
+	return &Mapper007{baseMapper: baseMapper{cart: c}}
+}
+
+func (m *Mapper007) cpuRead(addr uint16) (byte, bool) {
+	if addr >= prgRomMinAddr {
+		return m.readPrg(int(m.prgBank), axromPrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper007) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRomMinAddr {
+		rom, _ := m.cpuRead(addr)
+		data = m.busConflict(rom, data)
+
+		m.prgBank = data & 0x07
+		if data&0x10 > 0 {
+			m.cart.mirroring = mirrorOnescreenHi
+		} else {
+			m.cart.mirroring = mirrorOnescreenLo
+		}
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		m.cart.prgRamWrite(addr, data)
+	}
+}
+
+// 8KB of CHR RAM.
+func (m *Mapper007) ppuRead(addr uint16) byte {
+	return m.readChr(0, len(m.cart.chrMem), addr)
+}
+
+func (m *Mapper007) ppuWrite(addr uint16, data byte) {
+	m.writeChr(0, len(m.cart.chrMem), addr, data)
+}
+
+func (m *Mapper007) saveState(e *stateEncoder) {
+	e.write(m.prgBank)
+}
+
+func (m *Mapper007) loadState(d *stateDecoder) {
+	d.read(&m.prgBank)
+}
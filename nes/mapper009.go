@@ -0,0 +1,151 @@
+package nes
+
+// Mapper009 (MMC2) switches an 8KB bank of PRG ROM at $8000, with the last
+// three banks fixed at $A000-$FFFF. Each 4KB pattern table has two CHR banks,
+// switched between by a latch set when the PPU fetches tile $FD or $FE:
+//
+//	$A000-$AFFF: PRG bank
+//	$B000-$BFFF: CHR bank at $0000 for latch $FD
+//	$C000-$CFFF: CHR bank at $0000 for latch $FE
+//	$D000-$DFFF: CHR bank at $1000 for latch $FD
+//	$E000-$EFFF: CHR bank at $1000 for latch $FE
+//	$F000-$FFFF: mirroring (0: vertical, 1: horizontal)
+//
+// reference: https://wiki.nesdev.com/w/index.php/MMC2
+type Mapper009 struct {
+	baseMapper
+	mmc2Chr
+
+	prgBank byte
+}
+
+const mmc2PrgBankSize int = 8 * 1024
+
+func init() {
+	registerMapper(9, NewMapper009)
+}
+
+func NewMapper009(c *Cartridge) Mapper {
+	return &Mapper009{
+		baseMapper: baseMapper{cart: c},
+		mmc2Chr:    newMmc2Chr(false),
+	}
+}
+
+func (m *Mapper009) cpuRead(addr uint16) (byte, bool) {
+	if addr >= 0xA000 {
+		last := m.prgBanks(mmc2PrgBankSize) - 1
+		slot := int(addr-0xA000) / mmc2PrgBankSize
+		return m.readPrg(last-2+slot, mmc2PrgBankSize, addr), true
+	} else if addr >= prgRomMinAddr {
+		return m.readPrg(int(m.prgBank), mmc2PrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper009) cpuWrite(addr uint16, data byte) {
+	if addr >= 0xA000 && addr <= 0xAFFF {
+		m.prgBank = data & 0x0F
+	} else if addr >= 0xB000 {
+		m.writeRegister(m.cart, addr, data)
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		m.cart.prgRamWrite(addr, data)
+	}
+}
+
+func (m *Mapper009) ppuRead(addr uint16) byte {
+	return m.readChr(m.chrBankAt(addr), mmc2ChrBankSize, addr)
+}
+
+func (m *Mapper009) ppuWrite(addr uint16, data byte) {
+	m.writeChr(m.chrBankAt(addr), mmc2ChrBankSize, addr, data)
+}
+
+func (m *Mapper009) chrFetched(addr uint16) {
+	m.fetched(addr)
+}
+
+func (m *Mapper009) saveState(e *stateEncoder) {
+	e.write(m.prgBank)
+	m.mmc2Chr.saveState(e)
+}
+
+func (m *Mapper009) loadState(d *stateDecoder) {
+	d.read(&m.prgBank)
+	m.mmc2Chr.loadState(d)
+}
+
+// mmc2Chr is the CHR banking shared by MMC2 and MMC4.
+type mmc2Chr struct {
+	banks [2][2]byte // CHR banks for each pattern table, and each latch value
+	latch [2]byte    // 0: tile $FD fetched, 1: tile $FE fetched
+
+	// MMC4 sets latch 0 on fetching any row of tiles $FD/$FE, as latch 1
+	// does, MMC2 only on fetching their first row ($0FD8/$0FE8).
+	anyRowLatch0 bool
+}
+
+const mmc2ChrBankSize int = 4 * 1024
+
+func newMmc2Chr(anyRowLatch0 bool) mmc2Chr {
+	return mmc2Chr{
+		latch:        [2]byte{1, 1},
+		anyRowLatch0: anyRowLatch0,
+	}
+}
+
+// writeRegister writes to the CHR bank and mirroring registers at
+// $B000-$FFFF.
+func (m *mmc2Chr) writeRegister(c *Cartridge, addr uint16, data byte) {
+	switch addr & 0xF000 {
+	case 0xB000:
+		m.banks[0][0] = data & 0x1F
+	case 0xC000:
+		m.banks[0][1] = data & 0x1F
+	case 0xD000:
+		m.banks[1][0] = data & 0x1F
+	case 0xE000:
+		m.banks[1][1] = data & 0x1F
+	case 0xF000:
+		if data&0x01 == 0 {
+			c.mirroring = mirrorVertical
+		} else {
+			c.mirroring = mirrorHorizontal
+		}
+	}
+}
+
+// chrBankAt returns the 4KB CHR bank mapped at the given address.
+func (m *mmc2Chr) chrBankAt(addr uint16) int {
+	table := (addr >> 12) & 1
+
+	return int(m.banks[table][m.latch[table]])
+}
+
+// fetched sets the latches after a pattern table read, taking effect from the
+// next read.
+func (m *mmc2Chr) fetched(addr uint16) {
+	table := (addr >> 12) & 1
+	tile := addr & 0x0FF8
+	if table == 0 && !m.anyRowLatch0 && addr&0x07 != 0 {
+		return
+	}
+
+	switch tile {
+	case 0x0FD8:
+		m.latch[table] = 0
+	case 0x0FE8:
+		m.latch[table] = 1
+	}
+}
+
+func (m *mmc2Chr) saveState(e *stateEncoder) {
+	e.write(m.banks, m.latch)
+}
+
+func (m *mmc2Chr) loadState(d *stateDecoder) {
+	d.read(&m.banks, &m.latch)
+}
@@ -0,0 +1,70 @@
+package nes
+
+// Mapper010 (MMC4) banks CHR as MMC2 does (see Mapper009), but switches a 16KB
+// bank of PRG ROM at $8000, with the last bank fixed at $C000, and has 8KB of
+// PRG RAM.
+//
+// reference: https://wiki.nesdev.com/w/index.php/MMC4
+type Mapper010 struct {
+	baseMapper
+	mmc2Chr
+
+	prgBank byte
+}
+
+const mmc4PrgBankSize int = 16 * 1024
+
+func init() {
+	registerMapper(10, NewMapper010)
+}
+
+func NewMapper010(c *Cartridge) Mapper {
+	return &Mapper010{
+		baseMapper: baseMapper{cart: c},
+		mmc2Chr:    newMmc2Chr(true),
+	}
+}
+
+func (m *Mapper010) cpuRead(addr uint16) (byte, bool) {
+	if addr >= 0xC000 {
+		return m.readPrg(m.prgBanks(mmc4PrgBankSize)-1, mmc4PrgBankSize, addr), true
+	} else if addr >= prgRomMinAddr {
+		return m.readPrg(int(m.prgBank), mmc4PrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper010) cpuWrite(addr uint16, data byte) {
+	if addr >= 0xA000 && addr <= 0xAFFF {
+		m.prgBank = data & 0x0F
+	} else if addr >= 0xB000 {
+		m.writeRegister(m.cart, addr, data)
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		m.cart.prgRamWrite(addr, data)
+	}
+}
+
+func (m *Mapper010) ppuRead(addr uint16) byte {
+	return m.readChr(m.chrBankAt(addr), mmc2ChrBankSize, addr)
+}
+
+func (m *Mapper010) ppuWrite(addr uint16, data byte) {
+	m.writeChr(m.chrBankAt(addr), mmc2ChrBankSize, addr, data)
+}
+
+func (m *Mapper010) chrFetched(addr uint16) {
+	m.fetched(addr)
+}
+
+func (m *Mapper010) saveState(e *stateEncoder) {
+	e.write(m.prgBank)
+	m.mmc2Chr.saveState(e)
+}
+
+func (m *Mapper010) loadState(d *stateDecoder) {
+	d.read(&m.prgBank)
+	m.mmc2Chr.loadState(d)
+}
@@ -0,0 +1,243 @@
+package nes
+
+// Mapper021 (VRC2 and VRC4) switches two 8KB banks of PRG ROM and eight 1KB
+// banks of CHR ROM. The VRC4 adds a PRG banking mode, single-screen mirroring
+// and the VRC IRQ counter (see vrcIrq). Registers are selected by address bits
+// 12-15 and the chip's A0 and A1 inputs:
+//
+//	$8000-$8003: 8KB PRG bank at $8000, or $C000 in PRG mode 1
+//	$9000-$9001: mirroring
+//	$9002-$9003: PRG mode (bit 1), VRC4 only
+//	$A000-$A003: 8KB PRG bank at $A000
+//	$B000-$E003: CHR banks, 2 per register group: low 4 bits of a bank at
+//	             even registers, high bits at odd registers
+//	$F000-$F003: IRQ latch low and high 4 bits, control, acknowledge, VRC4
+//	             only
+//
+// Boards connect different CPU address lines to A0 and A1, told apart by
+// mapper number and NES 2.0 submapper (see vrcWiring). Mappers 21, 23 and 25
+// each cover several boards, so iNES 1.0 dumps, which have no submapper,
+// decode the address lines of all of them, as a VRC4. No game writes to the
+// addresses where they would conflict, but VRC2 games using the microwire
+// latch need an NES 2.0 header without PRG RAM.
+//
+// reference: https://wiki.nesdev.com/w/index.php/VRC2_and_VRC4
+type Mapper021 struct {
+	baseMapper
+	vrcWiring
+
+	prgRegs    [2]byte
+	chrRegs    [8]uint16
+	control    byte // $9002, VRC4 only
+	microwire  byte // VRC2 latch at $6000-$6FFF, without PRG RAM
+	irqCounter vrcIrq
+}
+
+// vrcWiring describes how a VRC2 or VRC4 is wired to a board.
+type vrcWiring struct {
+	a0, a1 uint16 // CPU address lines connected to A0 and A1, as bit masks
+	vrc2   bool   // VRC2, without the VRC4's PRG mode, mirroring and IRQ
+	chrA10 bool   // VRC2a: CHR bank registers' low bit isn't connected
+}
+
+const (
+	vrcPrgBankSize int = 8 * 1024
+	vrcChrBankSize int = 1024
+)
+
+func init() {
+	registerMapper(21, NewMapper021)
+}
+
+// Mapper 21: VRC4a (submapper 1, A1 and A2) and VRC4c (submapper 2, A6 and A7).
+func NewMapper021(c *Cartridge) Mapper {
+	switch c.Info.Submapper {
+	case 1:
+		return newVrc2And4(c, vrcWiring{a0: 0x02, a1: 0x04})
+	case 2:
+		return newVrc2And4(c, vrcWiring{a0: 0x40, a1: 0x80})
+	}
+
+	return newVrc2And4(c, vrcWiring{a0: 0x42, a1: 0x84})
+}
+
+func newVrc2And4(c *Cartridge, wiring vrcWiring) *Mapper021 {
+	return &Mapper021{
+		baseMapper: baseMapper{cart: c},
+		vrcWiring:  wiring,
+		irqCounter: newVrcIrq(),
+	}
+}
+
+func (m *Mapper021) cpuRead(addr uint16) (byte, bool) {
+	if addr >= prgRomMinAddr {
+		return m.readPrg(m.prgBankAt(addr), vrcPrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if m.hasMicrowire() {
+			return m.readMicrowire(addr)
+		}
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper021) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if m.hasMicrowire() {
+			if addr < 0x7000 {
+				m.microwire = data & 0x01
+			}
+			return
+		}
+		m.cart.prgRamWrite(addr, data)
+		return
+	} else if addr < prgRomMinAddr {
+		return
+	}
+
+	reg := addr & 0xF000
+	if addr&m.a0 > 0 {
+		reg |= 0x01
+	}
+	if addr&m.a1 > 0 {
+		reg |= 0x02
+	}
+
+	switch reg & 0xF000 {
+	case 0x8000:
+		m.prgRegs[0] = data & 0x1F
+	case 0x9000:
+		if m.vrc2 || reg&0x02 == 0 {
+			m.writeMirroring(data)
+		} else {
+			m.control = data & 0x03
+		}
+	case 0xA000:
+		m.prgRegs[1] = data & 0x1F
+	case 0xB000, 0xC000, 0xD000, 0xE000:
+		m.writeChrBank(reg, data)
+	case 0xF000:
+		if !m.vrc2 {
+			m.writeIrq(reg&0x03, data)
+		}
+	}
+}
+
+// hasMicrowire returns whether $6000-$6FFF holds the VRC2's 1-bit latch, used
+// by boards without PRG RAM.
+func (m *Mapper021) hasMicrowire() bool {
+	return m.vrc2 && len(m.cart.prgRam) == 0
+}
+
+// readMicrowire returns the latch in bit 0. The other bits aren't driven, and
+// are left as the high byte of the address, the last value on the data bus
+// for most instructions reading it.
+func (m *Mapper021) readMicrowire(addr uint16) (byte, bool) {
+	if addr >= 0x7000 {
+		return 0, false
+	}
+
+	return byte(addr>>8)&0xFE | m.microwire, true
+}
+
+// $9000: vertical, horizontal, single-screen low or high mirroring. The VRC2
+// only has the first 2.
+func (m *Mapper021) writeMirroring(data byte) {
+	mode := data & 0x03
+	if m.vrc2 {
+		mode &= 0x01
+	}
+
+	switch mode {
+	case 0:
+		m.cart.mirroring = mirrorVertical
+	case 1:
+		m.cart.mirroring = mirrorHorizontal
+	case 2:
+		m.cart.mirroring = mirrorOnescreenLo
+	case 3:
+		m.cart.mirroring = mirrorOnescreenHi
+	}
+}
+
+// writeChrBank sets 4 bits of one of the CHR banks: $B000-$B003 are the low
+// and high bits of banks 0 and 1, $C000-$C003 of banks 2 and 3, and so on.
+// The VRC2 has 4 high bits, the VRC4 5.
+func (m *Mapper021) writeChrBank(reg uint16, data byte) {
+	bank := (reg-0xB000)>>11 | (reg&0x02)>>1
+	if reg&0x01 == 0 {
+		m.chrRegs[bank] = m.chrRegs[bank]&0x1F0 | uint16(data&0x0F)
+	} else {
+		m.chrRegs[bank] = m.chrRegs[bank]&0x0F | uint16(data&0x1F)<<4
+	}
+}
+
+// writeIrq writes to the VRC4's IRQ registers, which split the latch into 2
+// 4-bit halves.
+func (m *Mapper021) writeIrq(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		m.irqCounter.latch = m.irqCounter.latch&0xF0 | data&0x0F
+	case 1:
+		m.irqCounter.latch = m.irqCounter.latch&0x0F | data<<4
+	default:
+		m.irqCounter.write(reg-1, data)
+	}
+}
+
+// prgBankAt returns the 8KB PRG ROM bank mapped at the given address. The
+// second last bank is fixed at $C000, or $8000 in PRG mode 1, and the last bank
+// at $E000.
+func (m *Mapper021) prgBankAt(addr uint16) int {
+	swapped := !m.vrc2 && m.control&0x02 > 0
+
+	switch {
+	case addr < 0xA000 && !swapped, addr >= 0xC000 && addr < 0xE000 && swapped:
+		return int(m.prgRegs[0])
+	case addr >= 0xA000 && addr < 0xC000:
+		return int(m.prgRegs[1])
+	case addr < 0xE000:
+		return m.prgBanks(vrcPrgBankSize) - 2
+	}
+
+	return m.prgBanks(vrcPrgBankSize) - 1
+}
+
+func (m *Mapper021) chrBankAt(addr uint16) int {
+	bank := m.chrRegs[(addr>>10)&0x07]
+	if m.vrc2 {
+		bank &= 0xFF
+	}
+	if m.chrA10 {
+		bank >>= 1
+	}
+
+	return int(bank)
+}
+
+func (m *Mapper021) ppuRead(addr uint16) byte {
+	return m.readChr(m.chrBankAt(addr), vrcChrBankSize, addr)
+}
+
+func (m *Mapper021) ppuWrite(addr uint16, data byte) {
+	m.writeChr(m.chrBankAt(addr), vrcChrBankSize, addr, data)
+}
+
+func (m *Mapper021) cpuClock() {
+	m.irqCounter.clock()
+}
+
+func (m *Mapper021) irq() bool {
+	return m.irqCounter.line
+}
+
+func (m *Mapper021) saveState(e *stateEncoder) {
+	e.write(m.prgRegs, m.chrRegs, m.control, m.microwire)
+	m.irqCounter.saveState(e)
+}
+
+func (m *Mapper021) loadState(d *stateDecoder) {
+	d.read(&m.prgRegs, &m.chrRegs, &m.control, &m.microwire)
+	m.irqCounter.loadState(d)
+}
@@ -0,0 +1,11 @@
+package nes
+
+// Mapper022 (VRC2a) is a VRC2 with A1 and A0 connected to its A0 and A1, whose
+// CHR banks ignore the low bit of their registers. See Mapper021.
+func init() {
+	registerMapper(22, NewMapper022)
+}
+
+func NewMapper022(c *Cartridge) Mapper {
+	return newVrc2And4(c, vrcWiring{a0: 0x02, a1: 0x01, vrc2: true, chrA10: true})
+}
@@ -0,0 +1,20 @@
+package nes
+
+// Mapper023 covers VRC4f (submapper 1, A0 and A1 connected to A0 and A1), VRC4e
+// (submapper 2, A2 and A3) and VRC2b (submapper 3, A0 and A1). See Mapper021.
+func init() {
+	registerMapper(23, NewMapper023)
+}
+
+func NewMapper023(c *Cartridge) Mapper {
+	switch c.Info.Submapper {
+	case 1:
+		return newVrc2And4(c, vrcWiring{a0: 0x01, a1: 0x02})
+	case 2:
+		return newVrc2And4(c, vrcWiring{a0: 0x04, a1: 0x08})
+	case 3:
+		return newVrc2And4(c, vrcWiring{a0: 0x01, a1: 0x02, vrc2: true})
+	}
+
+	return newVrc2And4(c, vrcWiring{a0: 0x05, a1: 0x0A})
+}
@@ -0,0 +1,277 @@
+package nes
+
+// Mapper024 (VRC6) switches a 16KB and an 8KB bank of PRG ROM, and eight 1KB
+// banks of CHR ROM, and has an IRQ counter and 3 expansion audio channels.
+// Registers are selected by address bits 12-15 and 0-1:
+//
+//	$8000-$8003: 16KB PRG bank at $8000
+//	$9000-$9003: pulse 1, and the audio frequency control
+//	$A000-$A002: pulse 2
+//	$B000-$B002: sawtooth
+//	$B003:       PPU banking mode, mirroring, PRG RAM enable
+//	$C000-$C003: 8KB PRG bank at $C000
+//	$D000-$D003: CHR banks R0-R3
+//	$E000-$E003: CHR banks R4-R7
+//	$F000-$F002: IRQ latch, control, acknowledge
+//
+// Mapper 26 boards connect CPU address lines A0 and A1 to the VRC6 the other
+// way round, so only the register addresses differ.
+//
+// reference: https://wiki.nesdev.com/w/index.php/VRC6
+type Mapper024 struct {
+	baseMapper
+
+	swapped bool // Address lines A0 and A1 are swapped, mapper 26
+
+	prgBank16 byte
+	prgBank8  byte
+	chrBanks  [8]byte
+	ppuMode   byte // $B003
+
+	irqCounter vrcIrq
+	audio      vrc6Audio
+}
+
+const (
+	vrc6PrgBankSize int = 8 * 1024
+	vrc6ChrBankSize int = 1024
+)
+
+func init() {
+	registerMapper(24, NewMapper024)
+}
+
+func NewMapper024(c *Cartridge) Mapper {
+	return newVrc6(c, false)
+}
+
+func newVrc6(c *Cartridge, swapped bool) *Mapper024 {
+	return &Mapper024{
+		baseMapper: baseMapper{cart: c},
+		swapped:    swapped,
+		irqCounter: newVrcIrq(),
+		audio:      newVrc6Audio(),
+	}
+}
+
+func (m *Mapper024) cpuRead(addr uint16) (byte, bool) {
+	if addr >= prgRomMinAddr {
+		return m.readPrg(m.prgBankAt(addr), vrc6PrgBankSize, addr), true
+	} else if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if m.ppuMode&0x80 == 0 {
+			return 0, false
+		}
+		return m.cart.prgRamRead(addr), true
+	}
+
+	return 0, false
+}
+
+func (m *Mapper024) cpuWrite(addr uint16, data byte) {
+	if addr >= prgRamMinAddr && addr <= prgRamMaxAddr {
+		if m.ppuMode&0x80 > 0 {
+			m.cart.prgRamWrite(addr, data)
+		}
+		return
+	} else if addr < prgRomMinAddr {
+		return
+	}
+
+	reg := addr & 0xF003
+	if m.swapped {
+		reg = addr&0xF000 | (addr&0x01)<<1 | (addr&0x02)>>1
+	}
+
+	switch reg & 0xF000 {
+	case 0x8000:
+		m.prgBank16 = data
+	case 0x9000, 0xA000:
+		m.audio.write(reg, data)
+	case 0xB000:
+		if reg == 0xB003 {
+			m.writePpuMode(data)
+		} else {
+			m.audio.write(reg, data)
+		}
+	case 0xC000:
+		m.prgBank8 = data
+	case 0xD000:
+		m.chrBanks[reg&0x03] = data
+	case 0xE000:
+		m.chrBanks[4+reg&0x03] = data
+	case 0xF000:
+		m.irqCounter.write(reg&0x03, data)
+	}
+}
+
+// $B003: PRG RAM enable (bit 7), mirroring (bits 2-3: vertical, horizontal,
+// single-screen low, single-screen high) and PPU banking mode (bits 0-1). The
+// modes using CHR ROM as nametables (bit 4) aren't used by any game, and
+// aren't emulated.
+func (m *Mapper024) writePpuMode(data byte) {
+	m.ppuMode = data
+
+	switch (data >> 2) & 0x03 {
+	case 0:
+		m.cart.mirroring = mirrorVertical
+	case 1:
+		m.cart.mirroring = mirrorHorizontal
+	case 2:
+		m.cart.mirroring = mirrorOnescreenLo
+	case 3:
+		m.cart.mirroring = mirrorOnescreenHi
+	}
+}
+
+// prgBankAt returns the 8KB PRG ROM bank mapped at the given address. The last
+// bank is fixed at $E000.
+func (m *Mapper024) prgBankAt(addr uint16) int {
+	switch {
+	case addr < 0xC000:
+		return int(m.prgBank16&0x0F)<<1 | int(addr>>13)&1
+	case addr < 0xE000:
+		return int(m.prgBank8 & 0x1F)
+	}
+
+	return m.prgBanks(vrc6PrgBankSize) - 1
+}
+
+// chrBankAt returns the 1KB CHR bank mapped at the given address. Mode 0 has
+// eight 1KB banks. Mode 1 has four 2KB banks, R0-R3, and modes 2 and 3 have
+// 1KB banks R0-R3 at $0000 and 2KB banks R4-R5 at $1000. 2KB banks take their
+// low bit from PPU address line A10.
+func (m *Mapper024) chrBankAt(addr uint16) int {
+	a10 := int(addr>>10) & 1
+
+	switch {
+	case m.ppuMode&0x03 == 0:
+		return int(m.chrBanks[(addr>>10)&0x07])
+	case m.ppuMode&0x03 == 1:
+		return int(m.chrBanks[(addr>>11)&0x03]&^1) | a10
+	case addr < patternTblSize:
+		return int(m.chrBanks[(addr>>10)&0x03])
+	}
+
+	return int(m.chrBanks[4+(addr>>11)&0x01]&^1) | a10
+}
+
+func (m *Mapper024) ppuRead(addr uint16) byte {
+	return m.readChr(m.chrBankAt(addr), vrc6ChrBankSize, addr)
+}
+
+func (m *Mapper024) ppuWrite(addr uint16, data byte) {
+	m.writeChr(m.chrBankAt(addr), vrc6ChrBankSize, addr, data)
+}
+
+func (m *Mapper024) cpuClock() {
+	m.irqCounter.clock()
+	m.audio.clock()
+}
+
+func (m *Mapper024) irq() bool {
+	return m.irqCounter.line
+}
+
+// audioOutput is the mix of the VRC6's pulse and sawtooth channels.
+func (m *Mapper024) audioOutput() float32 {
+	return m.audio.output()
+}
+
+func (m *Mapper024) maxAudioOutput() float32 {
+	return m.audio.maxOutput()
+}
+
+func (m *Mapper024) saveState(e *stateEncoder) {
+	e.write(m.prgBank16, m.prgBank8, m.chrBanks, m.ppuMode)
+	m.irqCounter.saveState(e)
+	m.audio.saveState(e)
+}
+
+func (m *Mapper024) loadState(d *stateDecoder) {
+	d.read(&m.prgBank16, &m.prgBank8, &m.chrBanks, &m.ppuMode)
+	m.irqCounter.loadState(d)
+	m.audio.loadState(d)
+}
+
+// vrcIrq is the IRQ counter of Konami's VRC4, VRC6 and VRC7. The 8-bit counter
+// counts up from the latch, interrupting the CPU when it overflows. It counts
+// either every CPU cycle, or every scanline using a prescaler that
+// approximates the length of a scanline in CPU cycles. Registers, relative to
+// the first:
+//
+//	0: latch
+//	1: control: counter mode (bit 2: cycles), enable (bit 1), enable after
+//	   acknowledgement (bit 0)
+//	2: acknowledge
+//
+// reference: https://wiki.nesdev.com/w/index.php/VRC_IRQ
+type vrcIrq struct {
+	latch     byte
+	counter   byte
+	prescaler int
+	control   byte
+	line      bool
+}
+
+// The prescaler counts down by 3 each CPU cycle, clocking the counter every
+// 113.667 cycles, 1 scanline.
+const vrcPrescalerPeriod int = 341
+
+func newVrcIrq() vrcIrq {
+	return vrcIrq{prescaler: vrcPrescalerPeriod}
+}
+
+func (irq *vrcIrq) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		irq.latch = data
+	case 1:
+		irq.control = data & 0x07
+		if irq.control&0x02 > 0 {
+			irq.counter = irq.latch
+			irq.prescaler = vrcPrescalerPeriod
+		}
+		irq.line = false
+	case 2:
+		// The enable after acknowledgement bit is copied to enable.
+		irq.line = false
+		irq.control = irq.control&^0x02 | (irq.control&0x01)<<1
+	}
+}
+
+// clock is called every CPU cycle.
+func (irq *vrcIrq) clock() {
+	if irq.control&0x02 == 0 {
+		return
+	}
+
+	if irq.control&0x04 > 0 {
+		irq.clockCounter()
+		return
+	}
+
+	irq.prescaler -= 3
+	if irq.prescaler <= 0 {
+		irq.prescaler += vrcPrescalerPeriod
+		irq.clockCounter()
+	}
+}
+
+func (irq *vrcIrq) clockCounter() {
+	if irq.counter == 0xFF {
+		irq.counter = irq.latch
+		irq.line = true
+	} else {
+		irq.counter++
+	}
+}
+
+func (irq *vrcIrq) saveState(e *stateEncoder) {
+	e.write(irq.latch, irq.counter, irq.control, irq.line)
+	e.writeInt(irq.prescaler)
+}
+
+func (irq *vrcIrq) loadState(d *stateDecoder) {
+	d.read(&irq.latch, &irq.counter, &irq.control, &irq.line)
+	d.readInt(&irq.prescaler)
+}
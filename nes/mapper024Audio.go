@@ -0,0 +1,204 @@
+package nes
+
+// vrc6Audio is the VRC6's expansion audio: 2 pulse channels with 8 duty
+// cycles, and a sawtooth channel. Its registers are:
+//
+//	$9000-$9002: pulse 1
+//	$9003:       frequency control
+//	$A000-$A002: pulse 2
+//	$B000-$B002: sawtooth
+//
+// Each channel's timer is clocked every CPU cycle, with a 12-bit period.
+//
+// reference: https://wiki.nesdev.com/w/index.php/VRC6_audio
+type vrc6Audio struct {
+	pulse [2]vrc6Pulse
+	saw   vrc6Saw
+
+	halt  bool // Stops every channel's timer
+	shift byte // Periods are shifted right by 0, 4 or 8 bits
+}
+
+// vrc6Pulse is a pulse channel whose duty cycle is 1 to 8 steps out of 16.
+type vrc6Pulse struct {
+	constant bool // Output the volume, ignoring the duty cycle
+	duty     byte // Steps the output is high for, minus 1
+	volume   byte
+	enabled  bool
+
+	timer  uint16
+	period uint16
+	step   byte // Counts down from 15
+}
+
+// vrc6Saw is a sawtooth channel, which adds its rate to an accumulator every
+// other clock of its timer, and resets it after 7 additions.
+type vrc6Saw struct {
+	rate    byte // 6 bits
+	enabled bool
+
+	timer       uint16
+	period      uint16
+	step        byte // 0-13
+	accumulator byte // The top 5 bits are output
+}
+
+func newVrc6Audio() vrc6Audio {
+	return vrc6Audio{
+		pulse: [2]vrc6Pulse{{step: 15}, {step: 15}},
+	}
+}
+
+// write writes to the register at the given address, normalised to $x000-$x003.
+func (a *vrc6Audio) write(reg uint16, data byte) {
+	if reg == 0x9003 {
+		// Halt (bit 0), periods shifted by 4 (bit 1) or by 8 (bit 2)
+		a.halt = data&0x01 > 0
+		switch {
+		case data&0x04 > 0:
+			a.shift = 8
+		case data&0x02 > 0:
+			a.shift = 4
+		default:
+			a.shift = 0
+		}
+		return
+	}
+
+	switch reg & 0xF000 {
+	case 0x9000:
+		a.pulse[0].write(reg&0x03, data)
+	case 0xA000:
+		a.pulse[1].write(reg&0x03, data)
+	case 0xB000:
+		a.saw.write(reg&0x03, data)
+	}
+}
+
+// clock is called every CPU cycle.
+func (a *vrc6Audio) clock() {
+	if a.halt {
+		return
+	}
+
+	a.pulse[0].clockTimer(a.shift)
+	a.pulse[1].clockTimer(a.shift)
+	a.saw.clockTimer(a.shift)
+}
+
+// output mixes the channels linearly, with each step of their levels as loud
+// as the first step of the APU's pulse channels.
+func (a *vrc6Audio) output() float32 {
+	level := a.pulse[0].output() + a.pulse[1].output() + a.saw.output()
+
+	return float32(level) * pulseMixTable[1]
+}
+
+// maxOutput returns output's highest level, with both pulse channels at
+// volume 15 and the sawtooth at 31.
+func (a *vrc6Audio) maxOutput() float32 {
+	return (15 + 15 + 31) * pulseMixTable[1]
+}
+
+func (a *vrc6Audio) saveState(e *stateEncoder) {
+	for i := range a.pulse {
+		p := &a.pulse[i]
+		e.write(p.constant, p.duty, p.volume, p.enabled, p.timer, p.period, p.step)
+	}
+	s := &a.saw
+	e.write(s.rate, s.enabled, s.timer, s.period, s.step, s.accumulator)
+	e.write(a.halt, a.shift)
+}
+
+func (a *vrc6Audio) loadState(d *stateDecoder) {
+	for i := range a.pulse {
+		p := &a.pulse[i]
+		d.read(&p.constant, &p.duty, &p.volume, &p.enabled, &p.timer, &p.period, &p.step)
+	}
+	s := &a.saw
+	d.read(&s.rate, &s.enabled, &s.timer, &s.period, &s.step, &s.accumulator)
+	d.read(&a.halt, &a.shift)
+}
+
+// Registers relative to the channel's first register.
+func (p *vrc6Pulse) write(reg uint16, data byte) {
+	switch reg {
+	case 0: // MDDD VVVV: constant volume mode, duty cycle, volume
+		p.constant = data&0x80 > 0
+		p.duty = (data >> 4) & 0x07
+		p.volume = data & 0x0F
+	case 1: // Period low 8 bits
+		p.period = p.period&0x0F00 | uint16(data)
+	case 2: // E--- PPPP: enable, period high 4 bits
+		p.period = p.period&0x00FF | uint16(data&0x0F)<<8
+		p.enabled = data&0x80 > 0
+		if !p.enabled {
+			p.step = 15
+		}
+	}
+}
+
+func (p *vrc6Pulse) clockTimer(shift byte) {
+	if !p.enabled {
+		return
+	}
+
+	if p.timer > 0 {
+		p.timer--
+		return
+	}
+
+	p.timer = p.period >> shift
+	p.step = (p.step - 1) & 0x0F
+}
+
+// output returns the channel's current volume, 0-15.
+func (p *vrc6Pulse) output() byte {
+	if !p.enabled || (!p.constant && p.step > p.duty) {
+		return 0
+	}
+
+	return p.volume
+}
+
+// Registers relative to the channel's first register.
+func (s *vrc6Saw) write(reg uint16, data byte) {
+	switch reg {
+	case 0: // --RR RRRR: accumulator rate
+		s.rate = data & 0x3F
+	case 1: // Period low 8 bits
+		s.period = s.period&0x0F00 | uint16(data)
+	case 2: // E--- PPPP: enable, period high 4 bits
+		s.period = s.period&0x00FF | uint16(data&0x0F)<<8
+		s.enabled = data&0x80 > 0
+		if !s.enabled {
+			s.step = 0
+			s.accumulator = 0
+		}
+	}
+}
+
+func (s *vrc6Saw) clockTimer(shift byte) {
+	if !s.enabled {
+		return
+	}
+
+	if s.timer > 0 {
+		s.timer--
+		return
+	}
+
+	s.timer = s.period >> shift
+	s.step++
+	if s.step == 14 {
+		s.step = 0
+		s.accumulator = 0
+	} else if s.step&1 == 0 {
+		s.accumulator += s.rate
+	}
+}
+
+// output returns the channel's current level, 0-31.
+func (s *vrc6Saw) output() byte {
+	return s.accumulator >> 3
+}
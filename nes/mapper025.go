@@ -0,0 +1,20 @@
+package nes
+
+// Mapper025 covers VRC4b (submapper 1, A1 and A0 connected to A0 and A1), VRC4d
+// (submapper 2, A3 and A2) and VRC2c (submapper 3, A1 and A0). See Mapper021.
+func init() {
+	registerMapper(25, NewMapper025)
+}
+
+func NewMapper025(c *Cartridge) Mapper {
+	switch c.Info.Submapper {
+	case 1:
+		return newVrc2And4(c, vrcWiring{a0: 0x02, a1: 0x01})
+	case 2:
+		return newVrc2And4(c, vrcWiring{a0: 0x08, a1: 0x04})
+	case 3:
+		return newVrc2And4(c, vrcWiring{a0: 0x02, a1: 0x01, vrc2: true})
+	}
+
+	return newVrc2And4(c, vrcWiring{a0: 0x0A, a1: 0x05})
+}
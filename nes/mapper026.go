@@ -0,0 +1,11 @@
+package nes
+
+// Mapper026 is the VRC6 with CPU address lines A0 and A1 swapped, see
+// Mapper024.
+func init() {
+	registerMapper(26, NewMapper026)
+}
+
+func NewMapper026(c *Cartridge) Mapper {
+	return newVrc6(c, true)
+}
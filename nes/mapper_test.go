@@ -0,0 +1,995 @@
+package nes
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestMapper000(t *testing.T) {
+	console := newTestConsole(t, testProgram)
+	bus := console.Bus()
+
+	// PRG ROM can't be overwritten.
+	bus.CpuWrite(0x8000, 0xFF)
+	if got := bus.CpuRead(0x8000); got != testProgram[0] {
+		t.Errorf("got $8000 = %#02X after writing to ROM, want %#02X", got, testProgram[0])
+	}
+
+	// 16KB PRG ROM is mirrored at $C000.
+	if got := bus.CpuRead(0xC000); got != testProgram[0] {
+		t.Errorf("got $C000 = %#02X, want %#02X", got, testProgram[0])
+	}
+
+	// Nothing drives the bus at $5000, reads return the last value on it.
+	bus.CpuWrite(0x0000, 0x42)
+	if got := bus.CpuRead(0x5000); got != 0x42 {
+		t.Errorf("got open bus $5000 = %#02X, want %#02X", got, 0x42)
+	}
+}
+
+// irqMapper is an NROM mapper with an IRQ line controlled by the test.
+type irqMapper struct {
+	Mapper
+	line bool
+}
+
+func (m *irqMapper) irq() bool { return m.line }
+
+func TestMapperIrq(t *testing.T) {
+	cart, err := LoadCartridge(bytes.NewReader(newTestRom(testProgram)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := NewConsole()
+	console.InsertCartridge(cart)
+	bus := console.Bus()
+
+	// Inserting the cartridge powers it on, creating its mapper.
+	mapper := &irqMapper{Mapper: cart.mapper}
+	cart.mapper = mapper
+
+	// Finish the reset sequence, then enable interrupts.
+	console.StepInstruction()
+	bus.Cpu.setFlag(StatusFlagI, false)
+
+	console.StepInstruction()
+	if bus.Cpu.Pc < 0x8000 || bus.Cpu.Pc > 0x8006 {
+		t.Fatalf("got PC %#04X without an IRQ, want the test program", bus.Cpu.Pc)
+	}
+
+	// The IRQ vector is $0000, from ROM filled with zeros.
+	mapper.line = true
+	for i := 0; i < 3; i++ {
+		console.StepInstruction()
+	}
+	if bus.Cpu.Pc >= 0x8000 {
+		t.Errorf("got PC %#04X with the IRQ line asserted, want the IRQ handler", bus.Cpu.Pc)
+	}
+}
+
+// newMapperTestRom returns an iNES file for the given mapper, with every 8KB
+// of PRG ROM and 1KB of CHR ROM filled with its bank number. Without any CHR
+// ROM, the cartridge has 8KB of CHR RAM.
+func newMapperTestRom(mapperId int, prgChunks, chrChunks byte) []byte {
+	header := []byte{'N', 'E', 'S', 0x1A, prgChunks, chrChunks,
+		byte(mapperId&0x0F) << 4, byte(mapperId & 0xF0), 0, 0, 0, 0, 0, 0, 0, 0}
+
+	prg := make([]byte, int(prgChunks)*16*1024)
+	for i := range prg {
+		prg[i] = byte(i / (8 * 1024))
+	}
+	chr := make([]byte, int(chrChunks)*8*1024)
+	for i := range chr {
+		chr[i] = byte(i / 1024)
+	}
+
+	return append(append(header, prg...), chr...)
+}
+
+// newMapperTestBus returns a bus with the given ROM inserted.
+func newMapperTestBus(t *testing.T, rom []byte) *Bus {
+	cart, err := LoadCartridge(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	console := NewConsole()
+	console.InsertCartridge(cart)
+
+	return console.Bus()
+}
+
+// writeSerial writes a 5-bit value to an MMC1 register, one bit at a time.
+func writeSerial(bus *Bus, addr uint16, value byte) {
+	for i := 0; i < 5; i++ {
+		bus.CpuWrite(addr, value>>i&1)
+		bus.Cart.cpuClock()
+		bus.Cart.cpuClock()
+	}
+}
+
+func TestMapper001(t *testing.T) {
+	bus := newMapperTestBus(t, newMapperTestRom(1, 8, 2))
+	cart := bus.Cart
+
+	checkPrg := func(name string, addr uint16, want byte) {
+		t.Helper()
+		if got := bus.CpuRead(addr); got != want {
+			t.Errorf("%s: got PRG bank %d at $%04X, want %d", name, got, addr, want)
+		}
+	}
+
+	// The last bank is fixed at $C000 at power on.
+	checkPrg("power on", 0xC000, 14)
+
+	writeSerial(bus, 0xE000, 3)
+	checkPrg("PRG mode 3", 0x8000, 6)
+	checkPrg("PRG mode 3", 0xC000, 14)
+
+	writeSerial(bus, 0x8000, 0x08) // PRG mode 2, single-screen
+	checkPrg("PRG mode 2", 0x8000, 0)
+	checkPrg("PRG mode 2", 0xC000, 6)
+	if cart.mirroring != mirrorOnescreenLo {
+		t.Errorf("got mirroring %v, want %v", cart.mirroring, mirrorOnescreenLo)
+	}
+
+	writeSerial(bus, 0x8000, 0x02) // PRG mode 0, vertical
+	checkPrg("PRG mode 0", 0x8000, 4)
+	checkPrg("PRG mode 0", 0xC000, 6)
+	if cart.mirroring != mirrorVertical {
+		t.Errorf("got mirroring %v, want %v", cart.mirroring, mirrorVertical)
+	}
+
+	// Writing bit 7 resets the shift register, and selects PRG mode 3.
+	bus.CpuWrite(0x8000, 1)
+	bus.Cart.cpuClock()
+	bus.Cart.cpuClock()
+	bus.CpuWrite(0x8000, mmc1ResetBit)
+	bus.Cart.cpuClock()
+	bus.Cart.cpuClock()
+	writeSerial(bus, 0xE000, 1)
+	checkPrg("reset", 0x8000, 2)
+	checkPrg("reset", 0xC000, 14)
+
+	// The second of two consecutive writes is ignored.
+	for i := 0; i < 5; i++ {
+		bus.CpuWrite(0xE000, 0)
+		bus.CpuWrite(0xE000, 1)
+		bus.Cart.cpuClock()
+		bus.Cart.cpuClock()
+	}
+	checkPrg("consecutive writes", 0x8000, 0)
+
+	// CHR banks, 8KB and 4KB modes.
+	writeSerial(bus, 0xA000, 3)
+	writeSerial(bus, 0xC000, 0)
+	if got := cart.ppuRead(0x1000); got != 12 {
+		t.Errorf("8KB CHR mode: got CHR bank %d at $1000, want %d", got, 12)
+	}
+	writeSerial(bus, 0x8000, 0x1C)
+	if got := cart.ppuRead(0x0000); got != 12 {
+		t.Errorf("4KB CHR mode: got CHR bank %d at $0000, want %d", got, 12)
+	}
+	if got := cart.ppuRead(0x1400); got != 1 {
+		t.Errorf("4KB CHR mode: got CHR bank %d at $1400, want %d", got, 1)
+	}
+
+	// PRG RAM is disabled by bit 4 of the PRG bank.
+	bus.CpuWrite(0x6000, 0x55)
+	writeSerial(bus, 0xE000, 0x10)
+	bus.CpuWrite(0x0000, 0xAA)
+	if got := bus.CpuRead(0x6000); got != 0xAA {
+		t.Errorf("got $6000 = %#02X with PRG RAM disabled, want open bus %#02X", got, 0xAA)
+	}
+	writeSerial(bus, 0xE000, 0x00)
+	if got := bus.CpuRead(0x6000); got != 0x55 {
+		t.Errorf("got $6000 = %#02X with PRG RAM enabled, want %#02X", got, 0x55)
+	}
+}
+
+func TestMapper001Surom(t *testing.T) {
+	// 512KB PRG ROM, 8KB CHR RAM
+	bus := newMapperTestBus(t, newMapperTestRom(1, 32, 0))
+
+	// Bit 4 of the CHR bank selects the 256KB half, including the fixed bank.
+	writeSerial(bus, 0xE000, 2)
+	if got := bus.CpuRead(0xC000); got != 30 {
+		t.Errorf("got PRG bank %d at $C000, want %d", got, 30)
+	}
+	writeSerial(bus, 0xA000, 0x10)
+	if got := bus.CpuRead(0x8000); got != 36 {
+		t.Errorf("got PRG bank %d at $8000, want %d", got, 36)
+	}
+	if got := bus.CpuRead(0xC000); got != 62 {
+		t.Errorf("got PRG bank %d at $C000, want %d", got, 62)
+	}
+}
+
+func TestDiscreteMappers(t *testing.T) {
+	// withSubmapper returns the ROM with a NES 2.0 header for the submapper.
+	withSubmapper := func(rom []byte, submapper int) []byte {
+		rom[7] |= 0x08
+		rom[8] = byte(submapper << 4)
+		return rom
+	}
+
+	tests := []struct {
+		name      string
+		rom       []byte
+		writeAddr uint16
+		data      byte
+		readAddr  uint16 // CPU address, or PPU address if below $2000
+		want      byte
+	}{
+		{"UxROM", newMapperTestRom(2, 8, 0), 0xC000, 3, 0x8000, 6},
+		{"UxROM fixed bank", newMapperTestRom(2, 8, 0), 0xC000, 3, 0xE000, 15},
+		{"UxROM bus conflicts", withSubmapper(newMapperTestRom(2, 8, 0), 2), 0xC000, 3, 0x8000, 4},
+		{"UxROM no bus conflicts", withSubmapper(newMapperTestRom(2, 8, 0), 1), 0xC000, 3, 0x8000, 6},
+		{"CNROM", newMapperTestRom(3, 2, 4), 0x8000, 2, 0x0400, 17},
+		{"CNROM bus conflicts", withSubmapper(newMapperTestRom(3, 2, 4), 2), 0xA000, 3, 0x0400, 9},
+		{"AxROM", newMapperTestRom(7, 8, 0), 0x8000, 2, 0xC000, 10},
+		{"AxROM bus conflicts", withSubmapper(newMapperTestRom(7, 8, 0), 2), 0x8000, 2, 0xC000, 2},
+	}
+
+	for _, test := range tests {
+		bus := newMapperTestBus(t, test.rom)
+		bus.CpuWrite(test.writeAddr, test.data)
+
+		var got byte
+		if test.readAddr < 0x2000 {
+			got = bus.Cart.ppuRead(test.readAddr)
+		} else {
+			got = bus.CpuRead(test.readAddr)
+		}
+		if got != test.want {
+			t.Errorf("%s: got bank %d at $%04X, want %d", test.name, got, test.readAddr, test.want)
+		}
+	}
+
+	// AxROM selects the single-screen nametable.
+	bus := newMapperTestBus(t, newMapperTestRom(7, 8, 0))
+	if bus.Cart.mirroring != mirrorOnescreenLo {
+		t.Errorf("AxROM: got mirroring %v at power on, want %v", bus.Cart.mirroring, mirrorOnescreenLo)
+	}
+	bus.CpuWrite(0x8000, 0x10)
+	if bus.Cart.mirroring != mirrorOnescreenHi {
+		t.Errorf("AxROM: got mirroring %v, want %v", bus.Cart.mirroring, mirrorOnescreenHi)
+	}
+}
+
+func TestMapper004(t *testing.T) {
+	// 128KB PRG ROM, 64KB CHR ROM
+	bus := newMapperTestBus(t, newMapperTestRom(4, 8, 8))
+	cart := bus.Cart
+
+	// R0-R7
+	for i, bank := range []byte{8, 3, 20, 21, 22, 23, 4, 5} {
+		bus.CpuWrite(0x8000, byte(i))
+		bus.CpuWrite(0x8001, bank)
+	}
+
+	tests := []struct {
+		bankSelect byte
+		addr       uint16 // CPU address, or PPU address if below $2000
+		want       byte
+	}{
+		{0x00, 0x8000, 4},
+		{0x00, 0xA000, 5},
+		{0x00, 0xC000, 14},
+		{0x00, 0xE000, 15},
+		{0x40, 0x8000, 14},
+		{0x40, 0xA000, 5},
+		{0x40, 0xC000, 4},
+		{0x40, 0xE000, 15},
+		{0x00, 0x0400, 9}, // 2KB bank, low bit ignored
+		{0x00, 0x0C00, 3},
+		{0x00, 0x1C00, 23},
+		{0x80, 0x0000, 20},
+		{0x80, 0x1400, 9},
+	}
+
+	for _, test := range tests {
+		bus.CpuWrite(0x8000, test.bankSelect)
+
+		var got byte
+		if test.addr < 0x2000 {
+			got = cart.ppuRead(test.addr)
+		} else {
+			got = bus.CpuRead(test.addr)
+		}
+		if got != test.want {
+			t.Errorf("bank select %#02X: got bank %d at $%04X, want %d",
+				test.bankSelect, got, test.addr, test.want)
+		}
+	}
+
+	bus.CpuWrite(0xA000, 0x01)
+	if cart.mirroring != mirrorHorizontal {
+		t.Errorf("got mirroring %v, want %v", cart.mirroring, mirrorHorizontal)
+	}
+
+	// Write protected PRG RAM.
+	bus.CpuWrite(0x6000, 0x12)
+	bus.CpuWrite(0xA001, 0xC0)
+	bus.CpuWrite(0x6000, 0x34)
+	if got := bus.CpuRead(0x6000); got != 0x12 {
+		t.Errorf("got $6000 = %#02X after a protected write, want %#02X", got, 0x12)
+	}
+}
+
+func TestMapperPowerCycle(t *testing.T) {
+	cart, err := LoadCartridge(bytes.NewReader(newMapperTestRom(4, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := NewConsole()
+	console.InsertCartridge(cart)
+
+	// MMC3: PRG bank 5 at $8000, vertical mirroring.
+	bus := console.Bus()
+	bus.CpuWrite(0x8000, 6)
+	bus.CpuWrite(0x8001, 5)
+	bus.CpuWrite(0xA000, 0)
+	if got := bus.CpuRead(0x8000); got != 5 {
+		t.Fatalf("got PRG bank %d at $8000, want %d", got, 5)
+	}
+
+	// Back to PRG bank 0, and the header's horizontal mirroring.
+	console.PowerCycle()
+	bus = console.Bus()
+	if got := bus.CpuRead(0x8000); got != 0 {
+		t.Errorf("got PRG bank %d at $8000 after power cycle, want %d", got, 0)
+	}
+	if cart.mirroring != mirrorHorizontal {
+		t.Errorf("got mirroring %v after power cycle, want %v", cart.mirroring, mirrorHorizontal)
+	}
+}
+
+func TestMapper004Irq(t *testing.T) {
+	tests := []struct {
+		name      string
+		submapper int
+		ctrl      byte // PPUCTRL, selecting the pattern tables
+		latch     byte
+		want      []int // Scanlines of the first 2 IRQs
+		wantCycle int   // PPU cycle of the IRQs, when A12 rises
+	}{
+		// A12 rises when fetching the first sprite's pattern.
+		{"MMC3", 0, 0x08, 10, []int{9, 20}, 261},
+		// A12 rises when fetching the next scanline's first tiles.
+		{"MMC3 background $1000", 0, 0x10, 10, []int{8, 19}, 325},
+		{"MMC3 latch 0", 0, 0x08, 0, []int{-1, 0}, 261},
+		{"MMC3A", mmc3ASubmapper, 0x08, 10, []int{9, 20}, 261},
+		{"MMC3A latch 0", mmc3ASubmapper, 0x08, 0, []int{-1}, 261},
+	}
+
+	for _, test := range tests {
+		rom := newMapperTestRom(4, 2, 1)
+		rom[7] |= 0x08
+		rom[8] = byte(test.submapper << 4)
+		bus := newMapperTestBus(t, rom)
+		ppu := bus.Ppu
+
+		// clock runs the PPU for a cycle, and the mapper every CPU cycle.
+		clock := func() {
+			ppu.Clock()
+			bus.ClockCount++
+			if bus.ClockCount%3 == 0 {
+				bus.Cart.cpuClock()
+			}
+		}
+
+		for ppu.scanline != 241 {
+			clock()
+		}
+		bus.CpuWrite(0x2000, test.ctrl)
+		bus.CpuWrite(0x2001, 0x18) // show background and sprites
+		bus.CpuWrite(0xC000, test.latch)
+		bus.CpuWrite(0xC001, 0)
+		bus.CpuWrite(0xE001, 0)
+
+		var got []int
+		for i := 0; i < 262*341 && len(got) < 2; i++ {
+			scanline, cycle := ppu.scanline, ppu.cycle
+			clock()
+			if bus.Cart.irq() {
+				if cycle != test.wantCycle {
+					t.Errorf("%s: got IRQ on cycle %d, want %d", test.name, cycle, test.wantCycle)
+				}
+				got = append(got, scanline)
+				bus.CpuWrite(0xE000, 0) // acknowledge
+				bus.CpuWrite(0xE001, 0)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got IRQs on scanlines %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMapper009And010(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapperId int
+		prgAddr  uint16
+		wantPrg  byte
+		rowLatch bool // Latch 0 set by any row of tiles $FD/$FE
+	}{
+		{"MMC2", 9, 0x8000, 3, false},
+		{"MMC4", 10, 0x8000, 6, true},
+	}
+
+	for _, test := range tests {
+		// 128KB PRG ROM, 128KB CHR ROM
+		bus := newMapperTestBus(t, newMapperTestRom(test.mapperId, 8, 16))
+		ppu := bus.Ppu
+
+		bus.CpuWrite(0xA000, 3)
+		if got := bus.CpuRead(test.prgAddr); got != test.wantPrg {
+			t.Errorf("%s: got PRG bank %d at $%04X, want %d", test.name, got, test.prgAddr, test.wantPrg)
+		}
+		if got := bus.CpuRead(0xE000); got != 15 {
+			t.Errorf("%s: got PRG bank %d at $E000, want %d", test.name, got, 15)
+		}
+
+		// CHR banks for latches $FD and $FE, in 1KB units.
+		bus.CpuWrite(0xB000, 1)
+		bus.CpuWrite(0xC000, 2)
+		bus.CpuWrite(0xD000, 3)
+		bus.CpuWrite(0xE000, 4)
+
+		checkChr := func(what string, addr uint16, want byte) {
+			t.Helper()
+			if got := bus.Cart.ppuRead(addr); got != want {
+				t.Errorf("%s: %s: got CHR bank %d at $%04X, want %d", test.name, what, got, addr, want)
+			}
+		}
+
+		checkChr("power on", 0x0000, 8)
+		checkChr("power on", 0x1000, 16)
+
+		// The latch switches banks after the tile is fetched.
+		if got := ppu.ppuRead(0x0FD8); got != 11 {
+			t.Errorf("%s: got CHR bank %d fetching tile $FD, want %d", test.name, got, 11)
+		}
+		checkChr("tile $FD fetched", 0x0000, 4)
+		ppu.ppuRead(0x1FEF)
+		checkChr("tile $FE fetched", 0x1000, 16)
+		ppu.ppuRead(0x1FD9)
+		checkChr("tile $FD fetched", 0x1000, 12)
+
+		// Only MMC4 switches on any row of tile $FE at $0000.
+		ppu.ppuRead(0x0FE9)
+		want := byte(4)
+		if test.rowLatch {
+			want = 8
+		}
+		checkChr("second row of tile $FE fetched", 0x0000, want)
+
+		bus.CpuWrite(0xF000, 1)
+		if bus.Cart.mirroring != mirrorHorizontal {
+			t.Errorf("%s: got mirroring %v, want %v", test.name, bus.Cart.mirroring, mirrorHorizontal)
+		}
+	}
+}
+
+func TestMapper005(t *testing.T) {
+	// 128KB PRG ROM, 16KB CHR ROM, 32KB PRG RAM
+	rom := newMapperTestRom(5, 8, 2)
+	rom[8] = 4
+	bus := newMapperTestBus(t, rom)
+	cart := bus.Cart
+
+	if got := bus.CpuRead(0xE000); got != 15 {
+		t.Errorf("power on: got PRG bank %d at $E000, want %d", got, 15)
+	}
+
+	prgTests := []struct {
+		mode  byte
+		regs  [4]byte // $5114-$5117
+		banks [4]byte // Banks at $8000, $A000, $C000 and $E000
+	}{
+		{0, [4]byte{0, 0, 0, 0x07}, [4]byte{4, 5, 6, 7}},
+		{1, [4]byte{0, 0x83, 0, 0x09}, [4]byte{2, 3, 8, 9}},
+		{2, [4]byte{0, 0x84, 0x8A, 0x0B}, [4]byte{4, 5, 10, 11}},
+		{3, [4]byte{0x83, 0x85, 0x86, 0x07}, [4]byte{3, 5, 6, 7}},
+	}
+	for _, test := range prgTests {
+		bus.CpuWrite(0x5100, test.mode)
+		for i, reg := range test.regs {
+			bus.CpuWrite(0x5114+uint16(i), reg)
+		}
+		for i, want := range test.banks {
+			addr := 0x8000 + uint16(i)*0x2000
+			if got := bus.CpuRead(addr); got != want {
+				t.Errorf("PRG mode %d: got bank %d at $%04X, want %d", test.mode, got, addr, want)
+			}
+		}
+	}
+
+	// PRG RAM, also mapped at $8000 in mode 3.
+	bus.CpuWrite(0x5102, 2)
+	bus.CpuWrite(0x5103, 1)
+	bus.CpuWrite(0x5113, 2)
+	bus.CpuWrite(0x6000, 0x42)
+	bus.CpuWrite(0x5114, 0x02)
+	if got := bus.CpuRead(0x8000); got != 0x42 {
+		t.Errorf("got $8000 = %#02X with PRG RAM bank 2, want %#02X", got, 0x42)
+	}
+	bus.CpuWrite(0x8000, 0x43)
+	bus.CpuWrite(0x5103, 0)
+	bus.CpuWrite(0x6000, 0x44)
+	if got := bus.CpuRead(0x6000); got != 0x43 {
+		t.Errorf("got $6000 = %#02X after a protected write, want %#02X", got, 0x43)
+	}
+	bus.CpuWrite(0x5113, 0)
+	if got := bus.CpuRead(0x6000); got != 0 {
+		t.Errorf("got $6000 = %#02X with PRG RAM bank 0, want 0", got)
+	}
+
+	// CHR banks, in 1KB units. Without 8x16 sprites, the last set written
+	// is used.
+	bus.CpuWrite(0x5101, 1)
+	bus.CpuWrite(0x5123, 1)
+	bus.CpuWrite(0x5127, 2)
+	if got := cart.ppuRead(0x0000); got != 4 {
+		t.Errorf("CHR mode 1: got bank %d at $0000, want %d", got, 4)
+	}
+	if got := cart.ppuRead(0x1400); got != 9 {
+		t.Errorf("CHR mode 1: got bank %d at $1400, want %d", got, 9)
+	}
+	bus.CpuWrite(0x512B, 3)
+	if got := cart.ppuRead(0x1400); got != 13 {
+		t.Errorf("CHR mode 1, set B: got bank %d at $1400, want %d", got, 13)
+	}
+	bus.CpuWrite(0x5101, 3)
+	bus.CpuWrite(0x5125, 7)
+	if got := cart.ppuRead(0x1400); got != 7 {
+		t.Errorf("CHR mode 3: got bank %d at $1400, want %d", got, 7)
+	}
+
+	// ExRAM as CPU RAM in mode 2, read-only in mode 3.
+	bus.CpuWrite(0x5104, 2)
+	bus.CpuWrite(0x5C10, 0x55)
+	bus.CpuWrite(0x5104, 3)
+	bus.CpuWrite(0x5C10, 0x66)
+	if got := bus.CpuRead(0x5C10); got != 0x55 {
+		t.Errorf("got $5C10 = %#02X, want %#02X", got, 0x55)
+	}
+
+	// CIRAM, ExRAM and fill mode nametables.
+	bus.CpuWrite(0x5104, 0)
+	bus.CpuWrite(0x5105, 0xE4)
+	bus.CpuWrite(0x5106, 0x33)
+	bus.CpuWrite(0x5107, 0x02)
+	ppu := bus.Ppu
+	ppu.ppuWrite(0x2001, 1)
+	ppu.ppuWrite(0x2401, 2)
+	ppu.ppuWrite(0x2801, 3)
+	ppu.ppuWrite(0x2C01, 4)
+	if ppu.nameTable[0][1] != 1 || ppu.nameTable[1][1] != 2 {
+		t.Errorf("got CIRAM %d and %d, want 1 and 2", ppu.nameTable[0][1], ppu.nameTable[1][1])
+	}
+	nametableTests := []struct {
+		addr uint16
+		want byte
+	}{
+		{0x2801, 3},
+		{0x2C01, 0x33},
+		{0x2FC1, 0xAA},
+	}
+	for _, test := range nametableTests {
+		if got := ppu.ppuRead(test.addr); got != test.want {
+			t.Errorf("got $%04X = %#02X, want %#02X", test.addr, got, test.want)
+		}
+	}
+
+	// 8x8 multiplier
+	bus.CpuWrite(0x5205, 200)
+	bus.CpuWrite(0x5206, 100)
+	if lo, hi := bus.CpuRead(0x5205), bus.CpuRead(0x5206); lo != 0x20 || hi != 0x4E {
+		t.Errorf("got product $%02X%02X, want $4E20", hi, lo)
+	}
+}
+
+func TestMapper005Irq(t *testing.T) {
+	bus := newMapperTestBus(t, newMapperTestRom(5, 8, 2))
+	ppu := bus.Ppu
+
+	clock := func() {
+		ppu.Clock()
+		bus.ClockCount++
+		if bus.ClockCount%3 == 0 {
+			bus.Cart.cpuClock()
+		}
+	}
+
+	for ppu.scanline != 241 {
+		clock()
+	}
+	bus.CpuWrite(0x2001, 0x18)
+	bus.CpuWrite(0x5203, 10)
+	bus.CpuWrite(0x5204, 0x80)
+
+	var got []int
+	var inFrame []bool
+	for i := 0; i < 2*262*341 && len(got) < 2; i++ {
+		scanline := ppu.scanline
+		clock()
+		if bus.Cart.irq() {
+			got = append(got, scanline)
+			status := bus.CpuRead(0x5204) // acknowledge
+			inFrame = append(inFrame, status&0x40 > 0)
+		}
+	}
+	if fmt.Sprint(got) != "[9 9]" {
+		t.Errorf("got IRQs on scanlines %v, want [9 9]", got)
+	}
+	if fmt.Sprint(inFrame) != "[true true]" {
+		t.Errorf("got in frame %v at the IRQs, want [true true]", inFrame)
+	}
+
+	for ppu.scanline != 245 {
+		clock()
+	}
+	if status := bus.CpuRead(0x5204); status != 0 {
+		t.Errorf("got status %#02X in vertical blank, want 0", status)
+	}
+}
+
+func TestMapper005Background(t *testing.T) {
+	// 128KB PRG ROM, 32KB CHR ROM
+	bus := newMapperTestBus(t, newMapperTestRom(5, 8, 4))
+	m := bus.Cart.mapper.(*Mapper005)
+	var ciram [2][1024]byte
+
+	// fetchTiles fetches the nametable bytes of the tiles before the given
+	// column on a scanline, after the 3 fetched on the previous one.
+	fetchTiles := func(scanline, column int) {
+		m.ppuScanline(scanline, true)
+		for tile := 3; tile < column; tile++ {
+			m.nametableRead(0x2000|uint16(scanline/8*32+tile), &ciram)
+		}
+	}
+
+	// ExRAM is filled in mode 2, as it reads back as 0 when written outside
+	// of rendering in modes 0 and 1.
+	bus.CpuWrite(0x5104, 2)
+	bus.CpuWrite(0x5C05, 0xC0|3) // Palette 3, 4KB bank 3
+	bus.CpuWrite(0x5C00+32+20, 0x77)
+
+	// Extended attributes
+	bus.CpuWrite(0x5104, 1)
+	fetchTiles(0, 5)
+	m.nametableRead(0x2005, &ciram)
+	if got, _ := m.nametableRead(0x23C1, &ciram); got != 0xFF {
+		t.Errorf("extended attributes: got attribute %#02X, want %#02X", got, 0xFF)
+	}
+	if got := m.ppuRead(0x0010); got != 12 {
+		t.Errorf("extended attributes: got CHR bank %d, want %d", got, 12)
+	}
+
+	// Vertical split on the right, from tile 16, using 4KB bank 2.
+	bus.CpuWrite(0x5104, 0)
+	bus.CpuWrite(0x5200, 0xC0|16)
+	bus.CpuWrite(0x5201, 0)
+	bus.CpuWrite(0x5202, 2)
+	fetchTiles(9, 20)
+	if got, _ := m.nametableRead(0x2000, &ciram); got != 0x77 {
+		t.Errorf("split: got tile %#02X, want %#02X", got, 0x77)
+	}
+	if got := m.ppuRead(0x0770); got != 9 {
+		t.Errorf("split: got CHR bank %d, want %d", got, 9)
+	}
+	fetchTiles(9, 15)
+	if got, _ := m.nametableRead(0x2000, &ciram); got != 0 {
+		t.Errorf("left of the split: got tile %#02X, want 0", got)
+	}
+
+	// With 8x16 sprites, the background uses CHR bank set B.
+	bus.CpuWrite(0x5200, 0)
+	bus.CpuWrite(0x5101, 3)
+	bus.CpuWrite(0x5120, 1)
+	bus.CpuWrite(0x5128, 2)
+	bus.CpuWrite(0x5120, 1)
+	bus.CpuWrite(0x2000, 0x20)
+	fetchTiles(0, 10)
+	if got := m.ppuRead(0x0000); got != 2 {
+		t.Errorf("8x16 sprites: got background CHR bank %d, want %d", got, 2)
+	}
+	fetchTiles(0, 35)
+	if got := m.ppuRead(0x0000); got != 1 {
+		t.Errorf("8x16 sprites: got sprite CHR bank %d, want %d", got, 1)
+	}
+}
+
+func TestMapper005Audio(t *testing.T) {
+	bus := newMapperTestBus(t, newMapperTestRom(5, 8, 2))
+
+	// Pulse 1 at constant volume 15, 50% duty.
+	bus.CpuWrite(0x5015, 0x01)
+	bus.CpuWrite(0x5000, 0xBF)
+	bus.CpuWrite(0x5002, 0x10)
+	bus.CpuWrite(0x5003, 0x08)
+	if got := bus.CpuRead(0x5015); got != 0x01 {
+		t.Errorf("got status %#02X, want %#02X", got, 0x01)
+	}
+
+	var peak float32
+	for i := 0; i < 1000; i++ {
+		bus.Cart.cpuClock()
+		if l := bus.Apu.levels()[ChannelExpansion]; l > peak {
+			peak = l
+		}
+	}
+	if peak != pulseMixTable[15] {
+		t.Errorf("got peak level %v, want %v", peak, pulseMixTable[15])
+	}
+
+	// PCM read mode interrupts on reading 0, from PRG bank 0.
+	bus.CpuWrite(0x5015, 0)
+	bus.CpuWrite(0x5114, 0x80)
+	bus.CpuWrite(0x5010, 0x81)
+	bus.CpuRead(0x8000)
+	if !bus.Cart.irq() {
+		t.Error("no IRQ after PCM read of 0")
+	}
+	if got := bus.CpuRead(0x5010); got != 0x80 || bus.Cart.irq() {
+		t.Errorf("got $5010 = %#02X, IRQ %v, want $80 and acknowledged", got, bus.Cart.irq())
+	}
+
+	bus.CpuWrite(0x5010, 0)
+	bus.CpuWrite(0x5011, 0x80)
+	if got := bus.Apu.levels()[ChannelExpansion]; got != tndMixTable[0x40] {
+		t.Errorf("got PCM level %v, want %v", got, tndMixTable[0x40])
+	}
+}
+
+func TestMapper024And026(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapperId int
+		reg1     uint16 // Offsets of registers 1 and 2 from the first
+		reg2     uint16
+	}{
+		{"VRC6a", 24, 1, 2},
+		{"VRC6b", 26, 2, 1},
+	}
+
+	for _, test := range tests {
+		// 128KB PRG ROM, 64KB CHR ROM
+		bus := newMapperTestBus(t, newMapperTestRom(test.mapperId, 8, 8))
+		cart := bus.Cart
+
+		bus.CpuWrite(0x8000, 3)
+		bus.CpuWrite(0xC000, 9)
+		for i, want := range []byte{6, 7, 9, 15} {
+			addr := 0x8000 + uint16(i)*0x2000
+			if got := bus.CpuRead(addr); got != want {
+				t.Errorf("%s: got PRG bank %d at $%04X, want %d", test.name, got, addr, want)
+			}
+		}
+
+		bus.CpuWrite(0xD000+test.reg1, 20)
+		bus.CpuWrite(0xE000+test.reg1, 41)
+		if got := cart.ppuRead(0x0400); got != 20 {
+			t.Errorf("%s: got CHR bank %d at $0400, want %d", test.name, got, 20)
+		}
+		if got := cart.ppuRead(0x1400); got != 41 {
+			t.Errorf("%s: got CHR bank %d at $1400, want %d", test.name, got, 41)
+		}
+
+		// $B003: PRG RAM enabled, horizontal mirroring, 2KB CHR banks
+		bus.CpuWrite(0xB003, 0x85)
+		if cart.mirroring != mirrorHorizontal {
+			t.Errorf("%s: got mirroring %v, want %v", test.name, cart.mirroring, mirrorHorizontal)
+		}
+		if got := cart.ppuRead(0x0C00); got != 21 {
+			t.Errorf("%s: 2KB banks: got CHR bank %d at $0C00, want %d", test.name, got, 21)
+		}
+		bus.CpuWrite(0x6000, 0x12)
+		if got := bus.CpuRead(0x6000); got != 0x12 {
+			t.Errorf("%s: got $6000 = %#02X, want %#02X", test.name, got, 0x12)
+		}
+
+		// Cycle mode IRQ, 3 cycles from the latch to overflowing.
+		bus.CpuWrite(0xF000, 0xFD)
+		bus.CpuWrite(0xF000+test.reg1, 0x06)
+		for i := 1; i <= 3; i++ {
+			if bus.Cart.irq() {
+				t.Errorf("%s: IRQ after %d cycles, want 3", test.name, i-1)
+			}
+			cart.cpuClock()
+		}
+		if !cart.irq() {
+			t.Errorf("%s: no IRQ after 3 cycles", test.name)
+		}
+		bus.CpuWrite(0xF000+test.reg2, 0)
+		if cart.irq() {
+			t.Errorf("%s: IRQ not acknowledged", test.name)
+		}
+
+		// Scanline mode IRQ, after 1 scanline of CPU cycles.
+		bus.CpuWrite(0xF000, 0xFF)
+		bus.CpuWrite(0xF000+test.reg1, 0x02)
+		cycles := 0
+		for !cart.irq() && cycles < 1000 {
+			cart.cpuClock()
+			cycles++
+		}
+		if cycles != 114 {
+			t.Errorf("%s: got scanline IRQ after %d cycles, want %d", test.name, cycles, 114)
+		}
+	}
+}
+
+func TestMapper024Audio(t *testing.T) {
+	bus := newMapperTestBus(t, newMapperTestRom(24, 8, 8))
+
+	// Pulse 1 at volume 15, high for 4 of 16 steps.
+	bus.CpuWrite(0x9000, 0x3F)
+	bus.CpuWrite(0x9001, 0x00)
+	bus.CpuWrite(0x9002, 0x80)
+
+	high := 0
+	for i := 0; i < 16; i++ {
+		bus.Cart.cpuClock()
+		if bus.Apu.levels()[ChannelExpansion] > 0 {
+			high++
+		}
+	}
+	if high != 4 {
+		t.Errorf("got pulse high for %d of 16 steps, want 4", high)
+	}
+
+	// Sawtooth rising by 8 every other step, reset every 14 steps.
+	bus.CpuWrite(0x9002, 0x00)
+	bus.CpuWrite(0xB000, 8)
+	bus.CpuWrite(0xB002, 0x80)
+	var got []byte
+	m := bus.Cart.mapper.(*Mapper024)
+	for i := 0; i < 14; i++ {
+		bus.Cart.cpuClock()
+		got = append(got, m.audio.saw.output())
+	}
+	if fmt.Sprint(got) != "[0 1 1 2 2 3 3 4 4 5 5 6 6 0]" {
+		t.Errorf("got sawtooth levels %v", got)
+	}
+
+	// The level meter is scaled by the VRC6's highest level, 15 for each
+	// pulse channel and 31 for the sawtooth.
+	bus.CpuWrite(0xB002, 0x00)
+	bus.CpuWrite(0x9000, 0x8F)
+	bus.CpuWrite(0x9002, 0x80)
+	bus.CpuWrite(0xA000, 0x8F)
+	bus.CpuWrite(0xA002, 0x80)
+	bus.Apu.SetLevelMetering(true)
+	bus.Apu.ChannelLevels()
+	bus.Apu.Clock()
+	want := float32(30) / 61
+	if got := bus.Apu.ChannelLevels()[ChannelExpansion]; math.Abs(float64(got-want)) > 1e-6 {
+		t.Errorf("got expansion meter level %f, want %f", got, want)
+	}
+}
+
+func TestMapper021To025(t *testing.T) {
+	tests := []struct {
+		name      string
+		mapperId  int
+		submapper int       // -1 for an iNES 1.0 header
+		regs      [3]uint16 // Offsets of registers 1-3 from the first
+		vrc2      bool
+		chrA10    bool
+	}{
+		{"VRC4a", 21, 1, [3]uint16{0x02, 0x04, 0x06}, false, false},
+		{"VRC4c", 21, 2, [3]uint16{0x40, 0x80, 0xC0}, false, false},
+		{"mapper 21 iNES", 21, -1, [3]uint16{0x40, 0x80, 0xC0}, false, false},
+		{"VRC2a", 22, 0, [3]uint16{0x02, 0x01, 0x03}, true, true},
+		{"VRC2a iNES", 22, -1, [3]uint16{0x02, 0x01, 0x03}, true, true},
+		{"VRC4f", 23, 1, [3]uint16{0x01, 0x02, 0x03}, false, false},
+		{"VRC4e", 23, 2, [3]uint16{0x04, 0x08, 0x0C}, false, false},
+		{"VRC2b", 23, 3, [3]uint16{0x01, 0x02, 0x03}, true, false},
+		{"mapper 23 iNES", 23, -1, [3]uint16{0x04, 0x08, 0x0C}, false, false},
+		{"VRC4b", 25, 1, [3]uint16{0x02, 0x01, 0x03}, false, false},
+		{"VRC4d", 25, 2, [3]uint16{0x08, 0x04, 0x0C}, false, false},
+		{"VRC2c", 25, 3, [3]uint16{0x02, 0x01, 0x03}, true, false},
+		{"mapper 25 iNES", 25, -1, [3]uint16{0x08, 0x04, 0x0C}, false, false},
+	}
+
+	for _, test := range tests {
+		// 128KB PRG ROM, 128KB CHR ROM
+		rom := newMapperTestRom(test.mapperId, 8, 16)
+		if test.submapper >= 0 {
+			// NES 2.0, without PRG RAM
+			rom[7] |= 0x08
+			rom[8] = byte(test.submapper << 4)
+		}
+		bus := newMapperTestBus(t, rom)
+		cart := bus.Cart
+		r1, r2, r3 := test.regs[0], test.regs[1], test.regs[2]
+
+		bus.CpuWrite(0x8000, 3)
+		bus.CpuWrite(0xA000+r1, 5)
+		for i, want := range []byte{3, 5, 14, 15} {
+			addr := 0x8000 + uint16(i)*0x2000
+			if got := bus.CpuRead(addr); got != want {
+				t.Errorf("%s: got PRG bank %d at $%04X, want %d", test.name, got, addr, want)
+			}
+		}
+
+		// CHR bank 1 = $12, bank 6 = 7
+		bus.CpuWrite(0xB000+r2, 0x02)
+		bus.CpuWrite(0xB000+r3, 0x01)
+		bus.CpuWrite(0xE000, 0x07)
+		bus.CpuWrite(0xE000+r1, 0x00)
+		want1, want6 := byte(0x12), byte(7)
+		if test.chrA10 {
+			want1, want6 = want1>>1, want6>>1
+		}
+		if got := cart.ppuRead(0x0400); got != want1 {
+			t.Errorf("%s: got CHR bank %d at $0400, want %d", test.name, got, want1)
+		}
+		if got := cart.ppuRead(0x1800); got != want6 {
+			t.Errorf("%s: got CHR bank %d at $1800, want %d", test.name, got, want6)
+		}
+
+		bus.CpuWrite(0x9000, 1)
+		if cart.mirroring != mirrorHorizontal {
+			t.Errorf("%s: got mirroring %v, want %v", test.name, cart.mirroring, mirrorHorizontal)
+		}
+
+		if test.vrc2 {
+			// No PRG mode: $9002 is another mirroring register.
+			bus.CpuWrite(0x9000+r2, 0x02)
+			if got := bus.CpuRead(0x8000); got != 3 {
+				t.Errorf("%s: got PRG bank %d at $8000, want %d", test.name, got, 3)
+			}
+			if cart.mirroring != mirrorVertical {
+				t.Errorf("%s: got mirroring %v, want %v", test.name, cart.mirroring, mirrorVertical)
+			}
+
+			if test.submapper >= 0 {
+				bus.CpuWrite(0x6000, 0xFF)
+				if got := bus.CpuRead(0x6000); got != 0x61 {
+					t.Errorf("%s: got microwire $6000 = %#02X, want %#02X", test.name, got, 0x61)
+				}
+				continue
+			}
+		} else {
+			bus.CpuWrite(0x9000+r2, 0x02)
+			if got := bus.CpuRead(0x8000); got != 14 {
+				t.Errorf("%s: PRG mode 1: got PRG bank %d at $8000, want %d", test.name, got, 14)
+			}
+			if got := bus.CpuRead(0xC000); got != 3 {
+				t.Errorf("%s: PRG mode 1: got PRG bank %d at $C000, want %d", test.name, got, 3)
+			}
+
+			// Cycle mode IRQ, 3 cycles from the latch to overflowing.
+			bus.CpuWrite(0xF000, 0x0D)
+			bus.CpuWrite(0xF000+r1, 0x0F)
+			bus.CpuWrite(0xF000+r2, 0x06)
+			for i := 1; i <= 3; i++ {
+				if cart.irq() {
+					t.Errorf("%s: IRQ after %d cycles, want 3", test.name, i-1)
+				}
+				cart.cpuClock()
+			}
+			if !cart.irq() {
+				t.Errorf("%s: no IRQ after 3 cycles", test.name)
+			}
+			bus.CpuWrite(0xF000+r3, 0)
+			if cart.irq() {
+				t.Errorf("%s: IRQ not acknowledged", test.name)
+			}
+		}
+
+		if test.submapper < 0 {
+			bus.CpuWrite(0x6000, 0x12)
+			if got := bus.CpuRead(0x6000); got != 0x12 {
+				t.Errorf("%s: got $6000 = %#02X, want %#02X", test.name, got, 0x12)
+			}
+		}
+	}
+}
@@ -102,7 +102,7 @@ type Ppu struct {
 	isSpriteZeroPossible bool
 	isSpriteZeroRendered bool
 
-	display *Display
+	sink FrameSink // Receives rendered pixels
 
 	paletteRGBA [paletteSize]color.RGBA
 
@@ -121,14 +121,14 @@ func NewPpu() *Ppu {
 
 		scanline:      0,
 		cycle:         0,
-		frameComplete: true,
+		frameComplete: false,
 
 		frames: 0,
 
 		vRam: new(PpuLoopyReg),
 		tRam: new(PpuLoopyReg),
 
-		paletteRGBA: loadPalette("./palettes/ntscpalette.pal"),
+		paletteRGBA: ntscPalette,
 
 		oam:            newOAM(64),
 		spriteScanline: newOAM(8),
@@ -139,8 +139,9 @@ func (p *Ppu) ConnectCartridge(c *Cartridge) {
 	p.Cart = c
 }
 
-func (p *Ppu) ConnectDisplay(d *Display) {
-	p.display = d
+// ConnectFrameSink sets where the PPU renders its pixels to.
+func (p *Ppu) ConnectFrameSink(s FrameSink) {
+	p.sink = s
 }
 
 // For future use if PPU logging is needed.
@@ -174,7 +175,13 @@ func (p *Ppu) Clock() {
 			p.frameComplete = true
 			p.frames++
 
-			p.display.UpdateScreen()
+			if p.sink != nil {
+				p.sink.EndFrame()
+			}
+		}
+
+		if p.Cart != nil {
+			p.Cart.ppuScanline(p.scanline, p.shouldRender())
 		}
 	}
 }
@@ -214,12 +221,12 @@ func (p *Ppu) calculateBackgroundPixel() {
 
 				// Nametable byte
 				fetchAddr = nameTblAddr | (p.vRam.value() & 0x0FFF)
-				p.nextBgTileId = p.ppuRead(fetchAddr)
+				p.nextBgTileId = p.fetch(fetchAddr)
 			case 2:
 				// Attribute table byte
 				fetchAddr = 0x23C0 | (p.vRam.value() & 0x0C00) |
 					((p.vRam.value() >> 4) & 0x38) | ((p.vRam.value() >> 2) & 0x07)
-				p.nextBgAttr = p.ppuRead(fetchAddr)
+				p.nextBgAttr = p.fetch(fetchAddr)
 
 				// TODO: figure this out and document it
 				if (p.vRam.getCoarseY() & 0x2) > 0 {
@@ -233,12 +240,12 @@ func (p *Ppu) calculateBackgroundPixel() {
 				// Pattern table tile low
 				fetchAddr = uint16(p.ppuCtrl.getFlag(ctrlBgPatternTbl))<<12 |
 					uint16(p.nextBgTileId)<<4 | uint16(p.vRam.getFineY()) + 0x0
-				p.nextBgTileLo = p.ppuRead(fetchAddr)
+				p.nextBgTileLo = p.fetch(fetchAddr)
 			case 6:
 				// Pattern table tile high
 				fetchAddr = uint16(p.ppuCtrl.getFlag(ctrlBgPatternTbl))<<12 |
 					uint16(p.nextBgTileId)<<4 | uint16(p.vRam.getFineY()) + 0x8
-				p.nextBgTileHi = p.ppuRead(fetchAddr)
+				p.nextBgTileHi = p.fetch(fetchAddr)
 			case 7:
 				// Increment horizontal scroll
 				if p.shouldRender() {
@@ -272,7 +279,7 @@ func (p *Ppu) calculateBackgroundPixel() {
 		// Unused nametable fetches at the end of each scnaline
 		if p.cycle == 337 || p.cycle == 339 {
 			fetchAddr := nameTblAddr | (p.vRam.value() & 0x0FFF)
-			p.nextBgTileId = p.ppuRead(fetchAddr)
+			p.nextBgTileId = p.fetch(fetchAddr)
 		}
 
 		// End of visible frame, transfer y position from tRam to vRam
@@ -349,9 +356,16 @@ func (p *Ppu) calculateForegroundPixel() {
 		p.spriteEvaluation()
 	}
 
-	// Sprite loading
-	if p.cycle == 340 {
-		p.loadSprites()
+	// Sprite pattern fetches, for the next visible scanline. Each of the 8
+	// sprite slots takes 8 cycles, fetching the low and high bytes of the
+	// pattern on its 5th and 7th cycles.
+	if p.cycle >= 257 && p.cycle <= 320 && p.scanline < 240 {
+		switch (p.cycle - 257) % 8 {
+		case 4:
+			p.loadSprite((p.cycle-257)/8, false)
+		case 6:
+			p.loadSprite((p.cycle-257)/8, true)
+		}
 	}
 
 	// Get the palette, pixel, and priority.
@@ -453,8 +467,10 @@ func (p *Ppu) drawPixel(x, y int) {
 	}
 
 	// Draw the pixel
-	clr := p.getColorFromPalette(palette, pixel)
-	p.display.DrawPixel(x, y, clr)
+	if p.sink != nil {
+		idx := p.getPaletteIndex(palette, pixel)
+		p.sink.SetPixel(x, y, idx, p.paletteRGBA[idx])
+	}
 }
 
 // Communicate with main (CPU) bus - used for PPU register access.
@@ -552,6 +568,9 @@ func (p *Ppu) cpuWrite(addr uint16, data byte) {
 
 			// Second read transfers tRam to vRam
 			*p.vRam = *p.tRam
+			if p.Cart != nil {
+				p.Cart.ppuAddress(p.vRam.value())
+			}
 
 			p.addrLatch = 0
 		}
@@ -581,9 +600,12 @@ func (p *Ppu) ppuRead(addr uint16) byte {
 		//tbl := (addr >> 12) & 0x1
 		//idx := addr & 0x0FFF
 		//data = p.patternTable[tbl][idx]
+		p.Cart.ppuAddress(addr)
 		data = p.Cart.ppuRead(addr)
+		p.Cart.chrFetched(addr)
 	} else if addr >= nameTblAddr && addr <= nameTblAddrEnd {
 		// Nametable read with the correct mirroring set by the game cartridge
+		p.Cart.ppuAddress(addr)
 		data = p.nametableRead(addr)
 	} else if addr >= paletteAddr && addr <= paletteAddrEnd {
 		// Mirrored addresses
@@ -604,9 +626,11 @@ func (p *Ppu) ppuWrite(addr uint16, data byte) {
 		//tbl := (addr >> 12) & 0x1
 		//idx := addr & 0x0FFF
 		//p.patternTable[tbl][idx] = data
+		p.Cart.ppuAddress(addr)
 		p.Cart.ppuWrite(addr, data)
 	} else if addr >= nameTblAddr && addr <= nameTblAddrEnd {
 		// Nametable write with the correct mirroring set by the game cartridge
+		p.Cart.ppuAddress(addr)
 		p.nametableWrite(addr, data)
 	} else if addr >= paletteAddr && addr <= paletteAddrEnd {
 		// Mirrored addresses
@@ -620,32 +644,17 @@ func (p *Ppu) ppuWrite(addr uint16, data byte) {
 
 // Gets a byte of data from the nametable memory using a given memory address.
 func (p *Ppu) nametableRead(addr uint16) byte {
-	var data byte
-
 	// Get an address relative to the nametable space (0x0000-0x0FFF)
 	addr &= 0x0FFF
-	nameTblId := getNametableId(addr)
 
-	switch nameTblId {
-	case 0:
-		data = p.nameTable[0][addr&0x3FF]
-	case 1:
-		if p.Cart.mirroring == mirrorHorizontal {
-			data = p.nameTable[0][addr&0x3FF] // mirror
-		} else if p.Cart.mirroring == mirrorVertical {
-			data = p.nameTable[1][addr&0x3FF]
-		}
-	case 2:
-		if p.Cart.mirroring == mirrorHorizontal {
-			data = p.nameTable[1][addr&0x3FF]
-		} else if p.Cart.mirroring == mirrorVertical {
-			data = p.nameTable[0][addr&0x3FF] // mirror
-		}
-	case 3:
-		data = p.nameTable[1][addr&0x3FF] // always mirror
+	// Some mappers provide the nametables themselves.
+	if data, ok := p.Cart.nametableRead(nameTblAddr|addr, &p.nameTable); ok {
+		return data
 	}
 
-	return data
+	nameTblId := getNametableId(addr)
+
+	return p.mirroredNametable(nameTblId)[addr&0x3FF]
 }
 
 // Write data to the appropriate nametable, determined by the address and what
@@ -653,25 +662,38 @@ func (p *Ppu) nametableRead(addr uint16) byte {
 func (p *Ppu) nametableWrite(addr uint16, data byte) {
 	// Relative nametable address
 	addr &= 0x0FFF
+	if p.Cart.nametableWrite(nameTblAddr|addr, data, &p.nameTable) {
+		return
+	}
+
 	nameTblId := getNametableId(addr)
 
-	switch nameTblId {
-	case 0:
-		p.nameTable[0][addr&0x3FF] = data
-	case 1:
-		if p.Cart.mirroring == mirrorHorizontal {
-			p.nameTable[0][addr&0x3FF] = data // mirror
-		} else if p.Cart.mirroring == mirrorVertical {
-			p.nameTable[1][addr&0x3FF] = data
-		}
-	case 2:
-		if p.Cart.mirroring == mirrorHorizontal {
-			p.nameTable[1][addr&0x3FF] = data
-		} else if p.Cart.mirroring == mirrorVertical {
-			p.nameTable[0][addr&0x3FF] = data // mirror
+	p.mirroredNametable(nameTblId)[addr&0x3FF] = data
+}
+
+// mirroredNametable returns the 1KB of memory backing the given nametable ID
+// (0, 1, 2, 3), according to the cartridge's mirroring mode.
+//
+// https://wiki.nesdev.com/w/index.php/Mirroring#Nametable_Mirroring
+func (p *Ppu) mirroredNametable(nameTblId byte) []byte {
+	switch p.Cart.mirroring {
+	case mirrorVertical:
+		// $2000 = $2800, $2400 = $2C00
+		return p.nameTable[nameTblId&0x1][:]
+	case mirrorOnescreenLo:
+		return p.nameTable[0][:]
+	case mirrorOnescreenHi:
+		return p.nameTable[1][:]
+	case mirrorFourScreen:
+		// Nametables 2 and 3 are provided by the cartridge.
+		if nameTblId < 2 {
+			return p.nameTable[nameTblId][:]
 		}
-	case 3:
-		p.nameTable[1][addr&0x3FF] = data // always mirror
+		offset := int(nameTblId-2) * 1024
+		return p.Cart.fourScreenRam[offset : offset+1024]
+	default:
+		// Horizontal: $2000 = $2400, $2800 = $2C00
+		return p.nameTable[nameTblId>>1][:]
 	}
 }
 
@@ -692,31 +714,63 @@ func getNametableId(addr uint16) byte {
 	return id
 }
 
-// LoadPalette loads an NES palette from the specified file path, and returns
-// and array of RGBA colors.
-func loadPalette(filepath string) [paletteSize]color.RGBA {
-	data, err := ioutil.ReadFile(filepath)
+// LoadPalette replaces the PPU's system palette with the NES palette at the
+// specified file path.
+func (p *Ppu) LoadPalette(filepath string) error {
+	palette, err := loadPalette(filepath)
 	if err != nil {
-		log.Fatal("Unable to open palette file.\n", err)
+		return err
 	}
 
+	p.paletteRGBA = palette
+
+	return nil
+}
+
+// loadPalette loads an NES palette from the specified file path, and returns
+// and array of RGBA colors.
+func loadPalette(filepath string) ([paletteSize]color.RGBA, error) {
 	palette := [paletteSize]color.RGBA{}
 
-	for i := 0; i < len(data); i += 3 {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return palette, err
+	}
+	if len(data) < int(paletteSize)*3 {
+		return palette, fmt.Errorf("palette file %v too short: %d bytes", filepath, len(data))
+	}
+
+	for i := 0; i < int(paletteSize)*3; i += 3 {
 		r := data[i]
 		g := data[i+1]
 		b := data[i+2]
 		palette[i/3] = color.RGBA{r, g, b, 255}
 	}
 
-	return palette
+	return palette, nil
+}
+
+// Get the system palette index from the given palette ID, offset by the given
+// pixel value.
+func (p *Ppu) getPaletteIndex(palette, pixel byte) byte {
+	idx := p.ppuRead(paletteAddr + uint16((palette<<2)+pixel))
+
+	return idx & 0x3F
 }
 
 // Get a color from the given palette ID, offset by the given pixel value.
 func (p *Ppu) getColorFromPalette(palette, pixel byte) color.RGBA {
-	idx := p.ppuRead(paletteAddr + uint16((palette<<2)+pixel))
+	return p.paletteRGBA[p.getPaletteIndex(palette, pixel)]
+}
+
+// fetch reads from the PPU bus while rendering. The PPU only fetches tiles
+// while rendering is enabled, so mappers don't see any accesses otherwise.
+func (p *Ppu) fetch(addr uint16) byte {
+	if !p.shouldRender() {
+		return 0
+	}
 
-	return p.paletteRGBA[idx&0x3F]
+	return p.ppuRead(addr)
 }
 
 // Check whether the PPU is in render mode. This is set by the maskBgShow and
@@ -902,25 +956,42 @@ func (p *Ppu) getSpritePatternAddr(sprite *oamSprite) (uint16, uint16) {
 	return addrLo, addrLo + 8
 }
 
-// loadSprites loads the sprites found on the current scanline to the sprite
-// shifters.
-func (p *Ppu) loadSprites() {
-	for spriteIdx := 0; spriteIdx < p.spriteCount; spriteIdx++ {
-		sprite := p.spriteScanline[spriteIdx]
+// loadSprite fetches the low or high byte of the pattern of a sprite found on
+// the current scanline, and loads it to the sprite's shifter.
+func (p *Ppu) loadSprite(spriteIdx int, hi bool) {
+	if spriteIdx >= p.spriteCount {
+		// Unused sprite slots fetch tile $FF, which mappers watching the
+		// PPU's address lines rely on.
+		dummyAddr := uint16(p.ppuCtrl.getFlag(ctrlSpritePatternTbl))<<12 | 0xFF<<4
+		if p.getSpriteSize() == 16 {
+			dummyAddr = 0x1000 | 0xFE<<4
+		}
+		if hi {
+			dummyAddr += 8
+		}
+		p.fetch(dummyAddr)
+		return
+	}
 
-		spritePatternAddrLo, spritePatternAddrHi := p.getSpritePatternAddr(sprite)
+	sprite := p.spriteScanline[spriteIdx]
+	spritePatternAddrLo, spritePatternAddrHi := p.getSpritePatternAddr(sprite)
 
-		// Read data
-		spritePatternDataLo := p.ppuRead(spritePatternAddrLo)
-		spritePatternDataHi := p.ppuRead(spritePatternAddrHi)
-		if sprite.isFlippedHorizontal() {
-			spritePatternDataLo = flipByte(spritePatternDataLo)
-			spritePatternDataHi = flipByte(spritePatternDataHi)
-		}
+	// Read data
+	var data byte
+	if hi {
+		data = p.fetch(spritePatternAddrHi)
+	} else {
+		data = p.fetch(spritePatternAddrLo)
+	}
+	if sprite.isFlippedHorizontal() {
+		data = flipByte(data)
+	}
 
-		// Load data to sprite shifters
-		p.spritePatternShifterLo[spriteIdx] = spritePatternDataLo
-		p.spritePatternShifterHi[spriteIdx] = spritePatternDataHi
+	// Load data to the sprite's shifter
+	if hi {
+		p.spritePatternShifterHi[spriteIdx] = data
+	} else {
+		p.spritePatternShifterLo[spriteIdx] = data
 	}
 }
 
@@ -937,9 +1008,10 @@ func (p *Ppu) GetPatternTable(i int) *image.RGBA {
 			memOffset := uint16(tileY*(16*16) + tileX*16)
 
 			for row := 0; row < 8; row++ {
-				// 2 bytes represent an 8 pixel row.
-				tileLo := p.ppuRead(patternTblSize*uint16(i) + memOffset + uint16(row))
-				tileHi := p.ppuRead(patternTblSize*uint16(i) + memOffset + uint16(row) + 8)
+				// 2 bytes represent an 8 pixel row. Read straight from the
+				// cartridge, so the mapper doesn't see the accesses.
+				tileLo := p.Cart.ppuRead(patternTblSize*uint16(i) + memOffset + uint16(row))
+				tileHi := p.Cart.ppuRead(patternTblSize*uint16(i) + memOffset + uint16(row) + 8)
 
 				for col := 0; col < 8; col++ {
 					// Calculate each pixel's value (0-3). The LSB represents
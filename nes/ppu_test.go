@@ -0,0 +1,69 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestNametableMirroring(t *testing.T) {
+	// For each mirroring mode, the lowest nametable ID (0-3) expected to
+	// share memory with the nametable at each index.
+	tests := []struct {
+		mirroring MirrorMode
+		want      [4]int
+	}{
+		{mirrorHorizontal, [4]int{0, 0, 2, 2}},
+		{mirrorVertical, [4]int{0, 1, 0, 1}},
+		{mirrorOnescreenLo, [4]int{0, 0, 0, 0}},
+		{mirrorOnescreenHi, [4]int{0, 0, 0, 0}},
+		{mirrorFourScreen, [4]int{0, 1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		ppu := NewPpu()
+		ppu.ConnectCartridge(newMirroringTestCartridge(test.mirroring))
+
+		// Write each nametable's ID to its first byte, in reverse order so
+		// that the lowest mirrored nametable wins.
+		for id := 3; id >= 0; id-- {
+			ppu.ppuWrite(nameTblAddr+uint16(id)*0x400, byte(id))
+		}
+
+		for id := 0; id < 4; id++ {
+			addr := nameTblAddr + uint16(id)*0x400
+			if got := ppu.ppuRead(addr); int(got) != test.want[id] {
+				t.Errorf("%v: got nametable %d at $%04X, want %d",
+					test.mirroring, got, addr, test.want[id])
+			}
+
+			// $3000-$3EFF mirrors $2000-$2EFF
+			if got := ppu.ppuRead(addr + 0x1000); int(got) != test.want[id] {
+				t.Errorf("%v: got nametable %d at $%04X, want %d",
+					test.mirroring, got, addr+0x1000, test.want[id])
+			}
+		}
+	}
+
+	// Single-screen modes use different memory.
+	ppu := NewPpu()
+	cart := newMirroringTestCartridge(mirrorOnescreenLo)
+	ppu.ConnectCartridge(cart)
+	ppu.ppuWrite(nameTblAddr, 0xAA)
+	cart.mirroring = mirrorOnescreenHi
+	ppu.ppuWrite(nameTblAddr, 0xBB)
+	cart.mirroring = mirrorOnescreenLo
+	if got := ppu.ppuRead(nameTblAddr + 0xC00); got != 0xAA {
+		t.Errorf("got single-screen (low) byte %#02X, want %#02X", got, 0xAA)
+	}
+}
+
+// newMirroringTestCartridge returns an NROM cartridge without any ROM, using
+// the given mirroring mode.
+func newMirroringTestCartridge(mirroring MirrorMode) *Cartridge {
+	cart := &Cartridge{
+		mirroring:     mirroring,
+		fourScreenRam: make([]byte, 2*1024),
+	}
+	cart.mapper = NewMapper000(cart)
+
+	return cart
+}
@@ -0,0 +1,181 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	rewindInterval int = 4   // Frames between rewind snapshots
+	rewindCapacity int = 900 // Snapshots kept, 60 seconds at 60 FPS
+)
+
+// rewindBuffer holds snapshots of the machine taken every few frames, so the
+// game can be run backwards. Only the newest snapshot is kept whole, older
+// snapshots are stored as deltas from the snapshot taken after them.
+//
+// Snapshots are save states without the header, see Bus.saveComponents.
+type rewindBuffer struct {
+	interval int // Frames between snapshots
+	frames   int // Frames since the last snapshot
+
+	latest []byte   // Newest snapshot
+	deltas [][]byte // Ring buffer of deltas, each from a snapshot to the one before it
+	start  int      // Index of the oldest delta
+	count  int      // Number of deltas in the ring buffer
+}
+
+func newRewindBuffer(interval, capacity int) *rewindBuffer {
+	return &rewindBuffer{
+		interval: interval,
+		deltas:   make([][]byte, capacity),
+	}
+}
+
+// clear discards all snapshots.
+func (r *rewindBuffer) clear() {
+	r.frames = 0
+	r.latest = nil
+	r.start = 0
+	r.count = 0
+	for i := range r.deltas {
+		r.deltas[i] = nil
+	}
+}
+
+// frame is called at the end of every frame, taking a snapshot of the bus
+// every interval frames.
+func (r *rewindBuffer) frame(b *Bus) {
+	r.frames++
+	if r.frames < r.interval {
+		return
+	}
+	r.frames = 0
+
+	var buf bytes.Buffer
+	if err := b.saveComponents(&buf); err != nil {
+		return
+	}
+	r.push(buf.Bytes())
+}
+
+// push adds a snapshot, dropping the oldest one if the buffer is full.
+func (r *rewindBuffer) push(snapshot []byte) {
+	if r.latest != nil && len(r.latest) == len(snapshot) && len(r.deltas) > 0 {
+		delta := encodeDelta(snapshot, r.latest)
+		if r.count == len(r.deltas) {
+			// Overwrite the oldest delta.
+			r.deltas[r.start] = delta
+			r.start = (r.start + 1) % len(r.deltas)
+		} else {
+			r.deltas[(r.start+r.count)%len(r.deltas)] = delta
+			r.count++
+		}
+	} else {
+		// Snapshots from before can't be restored from this one.
+		r.clear()
+	}
+
+	r.latest = snapshot
+}
+
+// pop removes and returns the newest snapshot, or nil if there are none.
+func (r *rewindBuffer) pop() []byte {
+	snapshot := r.latest
+	if snapshot == nil {
+		return nil
+	}
+
+	if r.count > 0 {
+		i := (r.start + r.count - 1) % len(r.deltas)
+		r.latest = applyDelta(snapshot, r.deltas[i])
+		r.deltas[i] = nil
+		r.count--
+	} else {
+		r.latest = nil
+	}
+	r.frames = 0
+
+	return snapshot
+}
+
+// Deltas are the XOR of two equal sized snapshots, mostly zeros as little of
+// the machine changes between snapshots. Runs of zeros are compressed, the
+// delta is a sequence of:
+//
+//	zero run length (uvarint)
+//	literal length (uvarint)
+//	literal bytes
+//
+// encodeDelta returns the delta that turns snapshot a into snapshot b.
+func encodeDelta(a, b []byte) []byte {
+	var delta []byte
+	var varint [binary.MaxVarintLen64]byte
+
+	for i := 0; i < len(a); {
+		zeros := 0
+		for i < len(a) && a[i] == b[i] {
+			zeros++
+			i++
+		}
+
+		literalStart := i
+		for i < len(a) && a[i] != b[i] {
+			i++
+		}
+
+		n := binary.PutUvarint(varint[:], uint64(zeros))
+		delta = append(delta, varint[:n]...)
+		n = binary.PutUvarint(varint[:], uint64(i-literalStart))
+		delta = append(delta, varint[:n]...)
+		for j := literalStart; j < i; j++ {
+			delta = append(delta, a[j]^b[j])
+		}
+	}
+
+	return delta
+}
+
+// applyDelta returns a new snapshot, from a snapshot and a delta returned by
+// encodeDelta.
+func applyDelta(snapshot, delta []byte) []byte {
+	result := append([]byte{}, snapshot...)
+
+	pos := 0
+	r := bytes.NewReader(delta)
+	for r.Len() > 0 {
+		zeros, err := binary.ReadUvarint(r)
+		if err != nil {
+			break
+		}
+		literals, err := binary.ReadUvarint(r)
+		if err != nil {
+			break
+		}
+
+		pos += int(zeros)
+		for i := 0; i < int(literals); i++ {
+			x, _ := r.ReadByte()
+			result[pos] ^= x
+			pos++
+		}
+	}
+
+	return result
+}
+
+// RewindFrame restores the newest rewind snapshot and renders the frame
+// following it. Returns false if there is nothing left to rewind.
+func (b *Bus) RewindFrame() bool {
+	snapshot := b.rewind.pop()
+	if snapshot == nil || b.Cart == nil {
+		return false
+	}
+
+	if err := b.loadComponents(bytes.NewReader(snapshot)); err != nil {
+		return false
+	}
+	b.clockFrame()
+
+	return true
+}
@@ -0,0 +1,74 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	a := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	b := []byte{0, 1, 9, 9, 4, 5, 6, 7, 8, 0}
+
+	delta := encodeDelta(a, b)
+	if got := applyDelta(b, delta); !bytes.Equal(got, a) {
+		t.Errorf("got %v, want %v", got, a)
+	}
+	if got := applyDelta(b, encodeDelta(b, b)); !bytes.Equal(got, b) {
+		t.Errorf("got %v from an empty delta, want %v", got, b)
+	}
+}
+
+func TestRewindBuffer(t *testing.T) {
+	r := newRewindBuffer(1, 3)
+	for i := byte(0); i < 5; i++ {
+		r.push([]byte{i, i, 0xFF, i * 2})
+	}
+
+	// The 2 oldest snapshots were dropped.
+	for i := 4; i >= 1; i-- {
+		want := []byte{byte(i), byte(i), 0xFF, byte(i * 2)}
+		if got := r.pop(); !bytes.Equal(got, want) {
+			t.Errorf("got snapshot %v, want %v", got, want)
+		}
+	}
+	if got := r.pop(); got != nil {
+		t.Errorf("got snapshot %v from empty buffer, want nil", got)
+	}
+}
+
+func TestConsoleRewind(t *testing.T) {
+	console := newTestConsole(t, countProgram)
+	bus := console.Bus()
+
+	// Snapshots are taken after frames 4 and 8. Rewinding restores a
+	// snapshot, then runs the next frame.
+	var want [][]byte
+	for frame := 1; frame <= 2*rewindInterval+1; frame++ {
+		console.RunFrame()
+		if frame%rewindInterval == 1 && frame > 1 {
+			var buf bytes.Buffer
+			if err := bus.saveComponents(&buf); err != nil {
+				t.Fatal(err)
+			}
+			want = append([][]byte{buf.Bytes()}, want...)
+		}
+	}
+
+	for i, w := range want {
+		if !console.Rewind() {
+			t.Fatalf("rewind %d: nothing to rewind to", i)
+		}
+
+		var got bytes.Buffer
+		if err := bus.saveComponents(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), w) {
+			t.Errorf("rewind %d: state differs from when it was first run", i)
+		}
+	}
+
+	if console.Rewind() {
+		t.Errorf("rewound past the oldest snapshot")
+	}
+}
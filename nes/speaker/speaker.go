@@ -0,0 +1,86 @@
+// Package speaker plays the NES's audio through the default sound card. It is
+// kept out of package nes, as it needs cgo and the platform's audio libraries
+// (ALSA on Linux).
+package speaker
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/hajimehoshi/oto"
+)
+
+const (
+	sampleRate int = 44100
+	bufferSize int = 8192 // Bytes buffered by the sound card, ~93ms
+	queueSize  int = 16   // Batches of samples waiting to be played
+)
+
+// Speaker is an nes.AudioSink that plays the APU's output through the default
+// sound card. Samples are played on a separate goroutine, if it falls behind
+// new samples are dropped rather than slowing down the emulator.
+type Speaker struct {
+	context *oto.Context
+	player  *oto.Player
+
+	queue chan []byte // 16-bit little endian samples, waiting to be played
+	done  chan struct{}
+}
+
+// New opens the default sound card.
+func New() (*Speaker, error) {
+	context, err := oto.NewContext(sampleRate, 1, 2, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Speaker{
+		context: context,
+		player:  context.NewPlayer(),
+		queue:   make(chan []byte, queueSize),
+		done:    make(chan struct{}),
+	}
+	go s.play()
+
+	return s, nil
+}
+
+func (s *Speaker) play() {
+	defer close(s.done)
+
+	for buf := range s.queue {
+		if _, err := s.player.Write(buf); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Speaker) SampleRate() int {
+	return sampleRate
+}
+
+func (s *Speaker) WriteSamples(samples []float32) {
+	buf := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		v := math.Max(-1, math.Min(1, float64(sample)))
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(int16(v*math.MaxInt16)))
+	}
+
+	select {
+	case s.queue <- buf:
+	default:
+		// Playback is behind, drop the samples.
+	}
+}
+
+// Close stops playback and releases the sound card.
+func (s *Speaker) Close() error {
+	close(s.queue)
+	<-s.done
+
+	if err := s.player.Close(); err != nil {
+		return err
+	}
+
+	return s.context.Close()
+}
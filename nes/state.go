@@ -0,0 +1,322 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Save states snapshot the whole machine: CPU, RAM, PPU, controllers and
+// cartridge. A save state starts with a header identifying the format version
+// and the ROM it was made with, followed by each component's state in a fixed
+// order. All values are little endian.
+//
+// Bump stateVersion whenever the layout changes, old save states are rejected
+// rather than loaded into the wrong fields.
+
+const stateVersion uint16 = 6
+
+// Save state file identifier.
+var stateMagic = [4]byte{'N', 'E', 'S', 'S'}
+
+// Errors returned when loading a save state.
+var (
+	ErrBadState       = errors.New("nes: not a save state")
+	ErrStateVersion   = errors.New("nes: unsupported save state version")
+	ErrStateRom       = errors.New("nes: save state is for a different ROM")
+	ErrTruncatedState = errors.New("nes: truncated save state")
+	ErrNoCartridge    = errors.New("nes: no cartridge inserted")
+)
+
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	RomHash [romHashSize]byte // See Cartridge.Hash
+}
+
+// stateEncoder writes save state values, keeping the first error so that
+// components don't have to check every write.
+type stateEncoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *stateEncoder) write(values ...interface{}) {
+	for _, v := range values {
+		if e.err != nil {
+			return
+		}
+		e.err = binary.Write(e.w, binary.LittleEndian, v)
+	}
+}
+
+// writeInt writes an int, which has no fixed size, as 64 bits.
+func (e *stateEncoder) writeInt(values ...int) {
+	for _, v := range values {
+		e.write(int64(v))
+	}
+}
+
+// stateDecoder reads save state values, keeping the first error.
+type stateDecoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *stateDecoder) read(values ...interface{}) {
+	for _, v := range values {
+		if d.err != nil {
+			return
+		}
+		d.err = binary.Read(d.r, binary.LittleEndian, v)
+	}
+}
+
+func (d *stateDecoder) readInt(values ...*int) {
+	for _, v := range values {
+		var i int64
+		d.read(&i)
+		*v = int(i)
+	}
+}
+
+// SaveState writes the state of the whole NES to w.
+func (b *Bus) SaveState(w io.Writer) error {
+	if b.Cart == nil {
+		return ErrNoCartridge
+	}
+
+	err := binary.Write(w, binary.LittleEndian, &stateHeader{
+		Magic:   stateMagic,
+		Version: stateVersion,
+		RomHash: b.Cart.Hash(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.saveComponents(w)
+}
+
+// saveComponents writes each component's state, following the header.
+func (b *Bus) saveComponents(w io.Writer) error {
+	e := &stateEncoder{w: w}
+
+	b.Cpu.saveState(e)
+	b.saveState(e)
+	b.Ppu.saveState(e)
+	b.Apu.saveState(e)
+	b.Cart.saveState(e)
+
+	return e.err
+}
+
+// LoadState restores the state of the whole NES from a save state written by
+// SaveState, with the same cartridge inserted. If the save state can't be
+// loaded the NES is left as it was.
+func (b *Bus) LoadState(r io.Reader) error {
+	if b.Cart == nil {
+		return ErrNoCartridge
+	}
+
+	header := new(stateHeader)
+	err := binary.Read(r, binary.LittleEndian, header)
+	if err != nil || header.Magic != stateMagic {
+		return ErrBadState
+	}
+	if header.Version != stateVersion {
+		return fmt.Errorf("%w: %d", ErrStateVersion, header.Version)
+	}
+	if header.RomHash != b.Cart.Hash() {
+		return ErrStateRom
+	}
+
+	// Keep the current state, to go back to if the save state turns out to
+	// be truncated part way through.
+	var backup bytes.Buffer
+	err = b.saveComponents(&backup)
+	if err != nil {
+		return err
+	}
+
+	err = b.loadComponents(r)
+	if err != nil {
+		b.loadComponents(&backup)
+		return fmt.Errorf("%w: %v", ErrTruncatedState, err)
+	}
+
+	return nil
+}
+
+// loadComponents reads each component's state, following the header.
+func (b *Bus) loadComponents(r io.Reader) error {
+	d := &stateDecoder{r: r}
+
+	b.Cpu.loadState(d)
+	b.loadState(d)
+	b.Ppu.loadState(d)
+	b.Apu.loadState(d)
+	b.Cart.loadState(d)
+
+	return d.err
+}
+
+// SaveStateFile writes a save state to the given slot's file, next to the ROM.
+func (b *Bus) SaveStateFile(slot int) error {
+	path, err := b.statePath(slot)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = b.SaveState(&buf)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// LoadStateFile loads the save state in the given slot's file.
+func (b *Bus) LoadStateFile(slot int) error {
+	path, err := b.statePath(slot)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return b.LoadState(bytes.NewReader(data))
+}
+
+// statePath returns the path of a save state slot's file, named after the ROM
+// file, e.g. "roms/DK.ss1" for slot 1 of "roms/DK.nes".
+func (b *Bus) statePath(slot int) (string, error) {
+	if b.Cart == nil {
+		return "", ErrNoCartridge
+	}
+	if b.Cart.romPath == "" {
+		return "", errors.New("nes: save state slots need a cartridge loaded from a file")
+	}
+
+	romPath := b.Cart.romPath
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+
+	return fmt.Sprintf("%s.ss%d", base, slot), nil
+}
+
+func (cpu *Cpu6502) saveState(e *stateEncoder) {
+	e.write(cpu.Pc, cpu.Sp, cpu.A, cpu.X, cpu.Y, cpu.Status)
+	e.write(cpu.Cycles, cpu.Opcode, cpu.AddrAbs, cpu.AddrRel, cpu.Fetched,
+		cpu.CycleCount, cpu.isImpliedAddr)
+}
+
+func (cpu *Cpu6502) loadState(d *stateDecoder) {
+	d.read(&cpu.Pc, &cpu.Sp, &cpu.A, &cpu.X, &cpu.Y, &cpu.Status)
+	d.read(&cpu.Cycles, &cpu.Opcode, &cpu.AddrAbs, &cpu.AddrRel, &cpu.Fetched,
+		&cpu.CycleCount, &cpu.isImpliedAddr)
+}
+
+func (b *Bus) saveState(e *stateEncoder) {
+	e.write(&b.Ram, &b.ControllerState)
+	e.writeInt(b.ClockCount)
+	e.write(b.dmaPage, b.dmaAddr, b.dmaData, b.dmaTransfer, b.dmaNeedSync)
+	e.writeInt(b.dmcStall)
+	e.write(b.openBus)
+}
+
+func (b *Bus) loadState(d *stateDecoder) {
+	d.read(&b.Ram, &b.ControllerState)
+	d.readInt(&b.ClockCount)
+	d.read(&b.dmaPage, &b.dmaAddr, &b.dmaData, &b.dmaTransfer, &b.dmaNeedSync)
+	d.readInt(&b.dmcStall)
+	d.read(&b.openBus)
+}
+
+func (p *Ppu) saveState(e *stateEncoder) {
+	e.write(&p.nameTable, &p.paletteTable)
+	e.write(p.ppuCtrl, p.ppuMask, p.ppuStatus, p.nmi)
+	e.writeInt(p.scanline, p.cycle, p.frames)
+	e.write(p.frameComplete, p.dataBuffer)
+
+	e.write(p.vRam, p.tRam, p.scrollFineX, p.addrLatch)
+	e.write(p.nextBgTileId, p.nextBgAttr, p.nextBgTileLo, p.nextBgTileHi)
+	e.write(p.bgPatternShifterLo, p.bgPatternShifterHi,
+		p.bgAttribShifterLo, p.bgAttribShifterHi)
+
+	e.saveOAM(p.oam)
+	e.write(p.oamAddr)
+	e.saveOAM(p.spriteScanline)
+	e.writeInt(p.spriteCount)
+	e.write(&p.spritePatternShifterLo, &p.spritePatternShifterHi)
+
+	e.write(p.bgPixel, p.fgPixel, p.bgPalette, p.fgPalette, p.fgPriority)
+	e.write(p.isSpriteZeroPossible, p.isSpriteZeroRendered)
+}
+
+func (p *Ppu) loadState(d *stateDecoder) {
+	d.read(&p.nameTable, &p.paletteTable)
+	d.read(p.ppuCtrl, p.ppuMask, p.ppuStatus, &p.nmi)
+	d.readInt(&p.scanline, &p.cycle, &p.frames)
+	d.read(&p.frameComplete, &p.dataBuffer)
+
+	d.read(p.vRam, p.tRam, &p.scrollFineX, &p.addrLatch)
+	d.read(&p.nextBgTileId, &p.nextBgAttr, &p.nextBgTileLo, &p.nextBgTileHi)
+	d.read(&p.bgPatternShifterLo, &p.bgPatternShifterHi,
+		&p.bgAttribShifterLo, &p.bgAttribShifterHi)
+
+	d.loadOAM(p.oam)
+	d.read(&p.oamAddr)
+	d.loadOAM(p.spriteScanline)
+	d.readInt(&p.spriteCount)
+	d.read(&p.spritePatternShifterLo, &p.spritePatternShifterHi)
+
+	d.read(&p.bgPixel, &p.fgPixel, &p.bgPalette, &p.fgPalette, &p.fgPriority)
+	d.read(&p.isSpriteZeroPossible, &p.isSpriteZeroRendered)
+}
+
+func (e *stateEncoder) saveOAM(oam objectAttributeMemory) {
+	for _, sprite := range oam {
+		e.write(sprite.y, sprite.id, sprite.attribute, sprite.x)
+	}
+}
+
+func (d *stateDecoder) loadOAM(oam objectAttributeMemory) {
+	for _, sprite := range oam {
+		d.read(&sprite.y, &sprite.id, &sprite.attribute, &sprite.x)
+	}
+}
+
+// Cartridge ROM is not saved, it is identified by the hash in the header.
+func (c *Cartridge) saveState(e *stateEncoder) {
+	e.write(c.prgRam, c.fourScreenRam)
+	if c.chrIsRam {
+		e.write(c.chrMem)
+	}
+	e.writeInt(int(c.mirroring))
+
+	c.mapper.saveState(e)
+}
+
+func (c *Cartridge) loadState(d *stateDecoder) {
+	d.read(c.prgRam, c.fourScreenRam)
+	if c.chrIsRam {
+		d.read(c.chrMem)
+	}
+	var mirroring int
+	d.readInt(&mirroring)
+	c.mirroring = MirrorMode(mirroring)
+
+	c.mapper.loadState(d)
+
+	// Loading a state changes PRG RAM, so the .sav file needs updating.
+	c.prgRamDirty = true
+}
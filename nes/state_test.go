@@ -0,0 +1,100 @@
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Counts up in $10 forever, so that the machine's state changes every frame:
+//
+//	INC $10
+//	JMP $8000
+var countProgram = []byte{0xE6, 0x10, 0x4C, 0x00, 0x80}
+
+func TestSaveState(t *testing.T) {
+	console := newTestConsole(t, countProgram)
+	console.RunFrame()
+	console.RunFrame()
+
+	var saved bytes.Buffer
+	if err := console.SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run on from the save state, twice, which should end in the same state.
+	runFrom := func() []byte {
+		if err := console.LoadState(bytes.NewReader(saved.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			console.RunFrame()
+		}
+
+		var buf bytes.Buffer
+		if err := console.SaveState(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	want := runFrom()
+	counter := console.Bus().Ram[0x10]
+	if got := runFrom(); !bytes.Equal(got, want) {
+		t.Errorf("state differs after running from the same save state")
+	}
+	if got := console.Bus().Ram[0x10]; got != counter {
+		t.Errorf("got counter %d, want %d", got, counter)
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	console := newTestConsole(t, countProgram)
+	console.RunFrame()
+
+	var saved bytes.Buffer
+	if err := console.SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	state := saved.Bytes()
+
+	// withByte returns a copy of the save state, with byte i set to b.
+	withByte := func(i int, b byte) []byte {
+		s := append([]byte{}, state...)
+		s[i] = b
+		return s
+	}
+
+	other := newTestConsole(t, testProgram)
+
+	tests := []struct {
+		name    string
+		console *Console
+		data    []byte
+		want    error
+	}{
+		{"empty", console, nil, ErrBadState},
+		{"bad magic", console, withByte(0, 'X'), ErrBadState},
+		{"newer version", console, withByte(4, 0xFF), ErrStateVersion},
+		{"different ROM", other, state, ErrStateRom},
+		{"truncated", console, state[:len(state)-1], ErrTruncatedState},
+	}
+
+	for _, test := range tests {
+		pc := test.console.Bus().Cpu.Pc
+		counter := test.console.Bus().Ram[0x10]
+
+		err := test.console.LoadState(bytes.NewReader(test.data))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+
+		// Failed loads leave the NES as it was.
+		if got := test.console.Bus().Cpu.Pc; got != pc {
+			t.Errorf("%s: got PC %#04X, want %#04X", test.name, got, pc)
+		}
+		if got := test.console.Bus().Ram[0x10]; got != counter {
+			t.Errorf("%s: got counter %d, want %d", test.name, got, counter)
+		}
+	}
+}
@@ -50,3 +50,10 @@ func setBit(b *byte, bitIdx int, newBit byte) {
 		*b |= (1 << bitIdx)
 	}
 }
+
+// Set all of a slice's bytes to 0.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
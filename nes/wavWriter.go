@@ -0,0 +1,112 @@
+package nes
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// WAV file header for mono 16-bit PCM audio.
+// reference: http://soundfile.sapp.org/doc/WaveFormat/
+type wavHeader struct {
+	ChunkId       [4]byte // "RIFF"
+	ChunkSize     uint32  // Size of the file following this field
+	Format        [4]byte // "WAVE"
+	Subchunk1Id   [4]byte // "fmt "
+	Subchunk1Size uint32  // Size of the rest of the fmt subchunk, 16 for PCM
+	AudioFormat   uint16  // 1 for PCM
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32 // SampleRate * NumChannels * BitsPerSample/8
+	BlockAlign    uint16 // NumChannels * BitsPerSample/8
+	BitsPerSample uint16
+	Subchunk2Id   [4]byte // "data"
+	Subchunk2Size uint32  // Size of the sample data
+}
+
+const wavHeaderSize = 44
+
+// WavWriter is an AudioSink that writes audio to a 16-bit PCM WAV file. The
+// header's sizes are only correct once the writer is closed.
+type WavWriter struct {
+	w    io.WriteSeeker
+	rate int
+
+	dataSize uint32 // Bytes of sample data written
+	buf      []byte // Reused for each batch of samples
+	err      error  // First error writing to w
+}
+
+// NewWavWriter writes a WAV header to w, ready for samples at the given rate.
+func NewWavWriter(w io.WriteSeeker, sampleRate int) (*WavWriter, error) {
+	wav := &WavWriter{
+		w:    w,
+		rate: sampleRate,
+	}
+
+	err := wav.writeHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	return wav, nil
+}
+
+func (wav *WavWriter) writeHeader() error {
+	header := wavHeader{
+		ChunkId:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     wavHeaderSize - 8 + wav.dataSize,
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1Id:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1,
+		NumChannels:   1,
+		SampleRate:    uint32(wav.rate),
+		ByteRate:      uint32(wav.rate) * 2,
+		BlockAlign:    2,
+		BitsPerSample: 16,
+		Subchunk2Id:   [4]byte{'d', 'a', 't', 'a'},
+		Subchunk2Size: wav.dataSize,
+	}
+
+	return binary.Write(wav.w, binary.LittleEndian, &header)
+}
+
+func (wav *WavWriter) SampleRate() int {
+	return wav.rate
+}
+
+func (wav *WavWriter) WriteSamples(samples []float32) {
+	if wav.err != nil {
+		return
+	}
+
+	wav.buf = wav.buf[:0]
+	for _, sample := range samples {
+		v := int16(math.Max(-1, math.Min(1, float64(sample))) * math.MaxInt16)
+		wav.buf = append(wav.buf, byte(v), byte(v>>8))
+	}
+
+	_, wav.err = wav.w.Write(wav.buf)
+	wav.dataSize += uint32(len(wav.buf))
+}
+
+// Close rewrites the header with the final sizes, and closes the underlying
+// writer if it is an io.Closer.
+func (wav *WavWriter) Close() error {
+	err := wav.err
+	if err == nil {
+		_, err = wav.w.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = wav.writeHeader()
+	}
+
+	if c, ok := wav.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,67 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestConsoleRecordWav(t *testing.T) {
+	console := newTestConsole(t, testProgram)
+	audio := NewAudioBuffer(22050)
+	console.ConnectAudioSink(audio)
+
+	path := filepath.Join(t.TempDir(), "out.wav")
+	if err := console.RecordWav(path); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := console.Bus()
+	bus.CpuWrite(0x4015, 0x01)
+	bus.CpuWrite(0x4000, 0xBF)
+	bus.CpuWrite(0x4002, 0xFD)
+	bus.CpuWrite(0x4003, 0x08)
+	for i := 0; i < 10; i++ {
+		console.RunFrame()
+	}
+
+	if err := console.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header wavHeader
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	if string(header.ChunkId[:]) != "RIFF" || string(header.Format[:]) != "WAVE" {
+		t.Fatalf("got header %q %q, want RIFF WAVE", header.ChunkId, header.Format)
+	}
+	if header.SampleRate != 22050 || header.BitsPerSample != 16 || header.NumChannels != 1 {
+		t.Errorf("got %dHz, %d bits, %d channels, want 22050Hz, 16 bits, 1 channel",
+			header.SampleRate, header.BitsPerSample, header.NumChannels)
+	}
+	if int(header.Subchunk2Size) != len(data)-wavHeaderSize ||
+		int(header.ChunkSize) != len(data)-8 {
+		t.Errorf("got sizes %d and %d, for a %d byte file", header.ChunkSize, header.Subchunk2Size, len(data))
+	}
+
+	// The recording matches what the audio sink received.
+	samples := make([]int16, header.Subchunk2Size/2)
+	binary.Read(bytes.NewReader(data[wavHeaderSize:]), binary.LittleEndian, samples)
+	if len(samples) != len(audio.Samples) {
+		t.Fatalf("got %d samples recorded, want %d", len(samples), len(audio.Samples))
+	}
+	for i, s := range samples {
+		want := int16(audio.Samples[i] * 32767)
+		if s != want {
+			t.Fatalf("sample %d: got %d, want %d", i, s, want)
+		}
+	}
+}